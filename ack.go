@@ -0,0 +1,77 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import "sync"
+
+// ackTracker tracks the acknowledgements of the lines sent from a
+// file, with Config.Ack.
+type ackTracker struct {
+	mu        sync.Mutex
+	committed int64       // Past the last line acknowledged with all those before it
+	pending   []*ackEntry // Lines sent after it, in order
+}
+
+// ackEntry is the acknowledgement of a line, ending at end.
+type ackEntry struct {
+	tracker *ackTracker
+	end     int64
+	acked   bool
+}
+
+func (t *ackTracker) add(end int64) *ackEntry {
+	e := &ackEntry{tracker: t, end: end}
+	t.mu.Lock()
+	t.pending = append(t.pending, e)
+	t.mu.Unlock()
+	return e
+}
+
+func (t *ackTracker) checkpoint() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+func (e *ackEntry) ack() {
+	t := e.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e.acked = true
+	for len(t.pending) > 0 && t.pending[0].acked {
+		t.committed = t.pending[0].end
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+}
+
+// Ack acknowledges the line was consumed, with Config.Ack: Checkpoint
+// advances past it once the lines before it are acknowledged too. It
+// does nothing otherwise, and may be called from any goroutine.
+func (line *Line) Ack() {
+	if line.ack != nil {
+		line.ack.ack()
+	}
+}
+
+// Checkpoint returns the position just past the lines acknowledged
+// with Line.Ack, without any line before them left unacknowledged,
+// with Config.Ack: tailing again from there, eg: after a crash, replays
+// the lines that were not. Lines of a file before it was reopened, or
+// before a Seek, no longer count. Without Config.Ack, it returns Tell.
+func (tail *Tail) Checkpoint() int64 {
+	tail.lk.Lock()
+	acks, delivered := tail.acks, tail.delivered
+	tail.lk.Unlock()
+	if acks == nil {
+		return delivered
+	}
+	return acks.checkpoint()
+}
+
+// resetAcks starts tracking acknowledgements from offset, with lk held.
+func (tail *Tail) resetAcks(offset int64) {
+	if tail.Ack {
+		tail.acks = &ackTracker{committed: offset}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// +build go1.23
+
+package tail
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the lines returned by Next:
+//
+//	for line, err := range t.All(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// It ends after the last line when tailing ends with io.EOF, and
+// otherwise after yielding the error, with a nil line. Breaking out of
+// the loop leaves the tail running: call Stop to end it.
+func (tail *Tail) All(ctx context.Context) iter.Seq2[*Line, error] {
+	return func(yield func(*Line, error) bool) {
+		for {
+			line, err := tail.Next(ctx)
+			if err == io.EOF {
+				return
+			}
+			if !yield(line, err) || err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// +build go1.23
+
+package tail
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAll(t *testing.T) {
+	tailTest := NewTailTest("all", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{})
+	var lines []string
+	for line, err := range tail.All(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line.Text)
+	}
+	if strings.Join(lines, ",") != "hello,world" {
+		t.Errorf("unexpected lines %q", lines)
+	}
+	tail.Cleanup()
+
+	// A tail failing to start yields its error.
+	tail = tailTest.StartTail("test.txt", Config{LocationTime: time.Now()})
+	var errs []error
+	for line, err := range tail.All(context.Background()) {
+		if line != nil {
+			t.Errorf("unexpected line %+v", line)
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil || !strings.Contains(errs[0].Error(), "TimeParser") {
+		t.Errorf("expected the error stopping the tail, got %v", errs)
+	}
+	tail.Cleanup()
+}
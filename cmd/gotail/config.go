@@ -0,0 +1,513 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/hpcloud/tail/ratelimiter"
+)
+
+// DEFAULT_RESCAN is how often the globs of a -config file are expanded
+// again to find new files, unless set by "rescan".
+var DEFAULT_RESCAN = 10 * time.Second
+
+// DEFAULT_MULTILINE_TIMEOUT is how long a multiline record waits for
+// its next line before being output, unless set by "timeout".
+var DEFAULT_MULTILINE_TIMEOUT = time.Second
+
+// configFile is the -config file, a JSON document describing several
+// inputs, eg:
+//
+//	{
+//	  "inputs": [{
+//	    "name": "app",
+//	    "paths": ["/var/log/app/*.log"],
+//	    "reopen": true,
+//	    "exclude": "DEBUG",
+//	    "multiline": {"continue": "^\\s"},
+//	    "rate_limit": {"burst": 100, "interval": "10ms"},
+//	    "output": {"path": "/var/log/all.ndjson", "format": "ndjson"}
+//	  }]
+//	}
+type configFile struct {
+	Inputs []inputConfig `json:"inputs"`
+	Rescan duration      `json:"rescan"`
+}
+
+// inputConfig is an input of a -config file: a set of files tailed
+// with the same settings, to the same output.
+type inputConfig struct {
+	Name         string           `json:"name"`
+	Paths        []string         `json:"paths"` // Files or globs
+	Follow       *bool            `json:"follow"`
+	ReOpen       bool             `json:"reopen"`
+	Poll         bool             `json:"poll"`
+	PollInterval duration         `json:"poll_interval"`
+	FromStart    bool             `json:"from_start"` // Rather than from the end of existing files
+	MaxLineSize  int              `json:"max_line_size"`
+	Grep         string           `json:"grep"`
+	Exclude      string           `json:"exclude"`
+	Multiline    *multilineConfig `json:"multiline"`
+	RateLimit    *rateLimitConfig `json:"rate_limit"`
+	Output       outputConfig     `json:"output"`
+}
+
+// multilineConfig joins lines into records: a line matching Start
+// begins a new record, or a line matching Continue is appended to the
+// current one.
+type multilineConfig struct {
+	Start    string   `json:"start"`
+	Continue string   `json:"continue"`
+	Timeout  duration `json:"timeout"`
+}
+
+// rateLimitConfig allows Burst lines at once, and one more line per
+// Interval.
+type rateLimitConfig struct {
+	Burst    uint16   `json:"burst"`
+	Interval duration `json:"interval"`
+}
+
+// outputConfig is where and how the lines of an input are written.
+// Path is appended to, or is the standard output when empty or "-".
+type outputConfig struct {
+	Path     string `json:"path"`
+	Format   string `json:"format"`
+	Template string `json:"template"`
+	Parse    string `json:"parse"`
+	Headers  bool   `json:"headers"`
+}
+
+// duration is a time.Duration written as a string, eg: "1.5s".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// loadConfig reads the -config file at path.
+func loadConfig(path string) (*configFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c configFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	for i, in := range c.Inputs {
+		if len(in.Paths) == 0 {
+			return nil, fmt.Errorf("%s: input %s has no paths", path, in.name(i))
+		}
+	}
+	return &c, nil
+}
+
+func (c *inputConfig) name(i int) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// key identifies the settings of an input, to keep it running across
+// reloads that do not change it.
+func (c *inputConfig) key() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+func (c *inputConfig) follow() bool {
+	return c.Follow == nil || *c.Follow
+}
+
+// input is a running input of a -config file.
+type input struct {
+	config    inputConfig
+	match     func(string) bool
+	start     *regexp.Regexp
+	cont      *regexp.Regexp
+	out       *printer
+	closer    io.Closer
+	stateFile *stateFile
+
+	mux   sync.Mutex // Of tails, from which run removes ended tails
+	tails map[string]*inputTail
+}
+
+type inputTail struct {
+	t    *tail.Tail
+	done chan struct{}
+}
+
+func newInput(c inputConfig, stdout io.Writer, state *stateFile) (*input, error) {
+	in := &input{config: c, tails: make(map[string]*inputTail), stateFile: state}
+	var err error
+	if in.match, err = newLineFilter(c.Grep, c.Exclude); err != nil {
+		return nil, err
+	}
+	if m := c.Multiline; m != nil {
+		if (m.Start == "") == (m.Continue == "") {
+			return nil, fmt.Errorf("multiline needs either start or continue")
+		}
+		if m.Start != "" {
+			in.start, err = regexp.Compile(m.Start)
+		} else {
+			in.cont, err = regexp.Compile(m.Continue)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline: %s", err)
+		}
+	}
+	if r := c.RateLimit; r != nil && (r.Burst == 0 || r.Interval.Duration <= 0) {
+		return nil, fmt.Errorf("rate_limit needs a burst and an interval")
+	}
+
+	o := c.Output
+	w := stdout
+	if o.Path != "" && o.Path != "-" {
+		f, err := os.OpenFile(o.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w, in.closer = f, f
+	}
+	if in.out, err = newPrinter(w, o.Format, o.Template, o.Parse, o.Headers); err != nil {
+		in.close()
+		return nil, err
+	}
+	return in, nil
+}
+
+func (in *input) tailConfig() tail.Config {
+	c := in.config
+	config := tail.Config{
+		Follow:       c.follow(),
+		ReOpen:       c.ReOpen && c.follow(),
+		Poll:         c.Poll,
+		PollInterval: c.PollInterval.Duration,
+		MaxLineSize:  c.MaxLineSize,
+		Logger:       tail.DiscardingLogger,
+	}
+	if r := c.RateLimit; r != nil {
+		config.RateLimiter = ratelimiter.NewLeakyBucket(r.Burst, r.Interval.Duration)
+	}
+	return config
+}
+
+// scan starts tailing the files matching the paths of the input that
+// are not tailed yet. Paths without glob characters are tailed even
+// before they exist.
+func (in *input) scan() {
+	for _, pattern := range in.config.Paths {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			in.startTail(pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				in.startTail(path)
+			}
+		}
+	}
+}
+
+func (in *input) startTail(path string) {
+	in.mux.Lock()
+	running := in.tails[path] != nil
+	in.mux.Unlock()
+	if running {
+		return
+	}
+	config := in.tailConfig()
+	if in.stateFile != nil && in.stateFile.has(path) {
+		opts := options{config: config}
+		config.Location = in.stateFile.resume(path, func(rotated string, offset int64) {
+			catchUp(rotated, path, offset, opts, in.out)
+		})
+	} else if _, err := os.Stat(path); err == nil && !in.config.FromStart {
+		config.Location = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	}
+	t, err := tail.TailFile(path, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", path, err)
+		return
+	}
+	in.out.header(path)
+	it := &inputTail{t, make(chan struct{})}
+	in.mux.Lock()
+	in.tails[path] = it
+	in.mux.Unlock()
+	go in.run(path, it)
+}
+
+// running returns the tails of the input that did not end.
+func (in *input) running() []*inputTail {
+	in.mux.Lock()
+	defer in.mux.Unlock()
+	tails := make([]*inputTail, 0, len(in.tails))
+	for _, it := range in.tails {
+		tails = append(tails, it)
+	}
+	return tails
+}
+
+// run outputs the lines of a tail, joining them into records with a
+// multiline rule. Once the tail ends, it is removed from the input so
+// that scan starts it again, for example after the file is deleted and
+// created anew, and so that files gone for good are forgotten.
+func (in *input) run(path string, it *inputTail) {
+	defer close(it.done)
+	defer func() {
+		in.mux.Lock()
+		defer in.mux.Unlock()
+		if in.tails[path] == it {
+			delete(in.tails, path)
+		}
+	}()
+	timeout := DEFAULT_MULTILINE_TIMEOUT
+	if m := in.config.Multiline; m != nil && m.Timeout.Duration > 0 {
+		timeout = m.Timeout.Duration
+	}
+
+	// pending is the record being joined, whose last line is last.
+	var pending *record
+	var last *tail.Line
+	var flushAfter <-chan time.Time
+	flush := func() {
+		if pending == nil {
+			return
+		}
+		if in.match(pending.Text) {
+			if err := in.out.print(pending); err != nil {
+				fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", path, err)
+			}
+		}
+		if in.stateFile != nil {
+			// Resume after the record, now that it is output.
+			in.stateFile.update(path, last)
+		}
+		pending, last, flushAfter = nil, nil, nil
+	}
+	for {
+		select {
+		case line, ok := <-it.t.Lines:
+			if !ok {
+				flush()
+				return
+			}
+			if line.Err != nil {
+				fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", path, line.Err)
+				continue
+			}
+			if pending != nil && in.continues(line.Text) {
+				pending.Text += "\n" + line.Text
+			} else {
+				flush()
+				pending = &record{
+					Input:  in.config.Name,
+					File:   path,
+					Offset: line.Offset,
+					Time:   line.Time,
+					Text:   line.Text,
+				}
+			}
+			last = line
+			if in.start == nil && in.cont == nil {
+				flush()
+			} else {
+				flushAfter = time.After(timeout)
+			}
+		case <-flushAfter:
+			flush()
+		}
+	}
+}
+
+// continues returns whether a line belongs to the current multiline
+// record.
+func (in *input) continues(text string) bool {
+	if in.start != nil {
+		return !in.start.MatchString(text)
+	}
+	return in.cont != nil && in.cont.MatchString(text)
+}
+
+// stop stops the tails of the input, once their lines are output, and
+// closes its output.
+func (in *input) stop() {
+	for _, it := range in.running() {
+		go it.t.Stop()
+	}
+	in.wait()
+	in.close()
+}
+
+// wait waits for the tails of the input to end.
+func (in *input) wait() {
+	for _, it := range in.running() {
+		<-it.done
+	}
+}
+
+func (in *input) close() {
+	if in.closer != nil {
+		in.closer.Close()
+	}
+}
+
+// runner runs the inputs of a -config file, reloading it on SIGHUP.
+type runner struct {
+	path   string
+	state  *stateFile
+	stdout io.Writer
+	inputs map[string]*input
+	rescan time.Duration
+}
+
+// load (re)loads the -config file. Inputs whose settings did not
+// change keep running; others are stopped or started. On error, the
+// previous inputs keep running.
+func (r *runner) load() error {
+	c, err := loadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	inputs := make(map[string]*input)
+	var started []*input
+	for i, ic := range c.Inputs {
+		key := ic.key()
+		if inputs[key] != nil {
+			continue
+		}
+		if in := r.inputs[key]; in != nil {
+			inputs[key] = in
+			continue
+		}
+		in, err := newInput(ic, r.stdout, r.state)
+		if err != nil {
+			for _, in := range started {
+				in.close()
+			}
+			return fmt.Errorf("input %s: %s", ic.name(i), err)
+		}
+		inputs[key] = in
+		started = append(started, in)
+	}
+
+	for key, in := range r.inputs {
+		if inputs[key] == nil {
+			in.stop()
+		}
+	}
+	r.inputs = inputs
+	r.rescan = c.Rescan.Duration
+	if r.rescan <= 0 {
+		r.rescan = DEFAULT_RESCAN
+	}
+	r.scan()
+	return nil
+}
+
+func (r *runner) scan() {
+	for _, in := range r.inputs {
+		in.scan()
+	}
+}
+
+func (r *runner) following() bool {
+	for _, in := range r.inputs {
+		if in.config.follow() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *runner) stop() {
+	for _, in := range r.inputs {
+		in.stop()
+	}
+}
+
+// runConfig runs "gotail -config path": it tails the inputs of the
+// config file until interrupted, reloading it on SIGHUP.
+func runConfig(path string, state *stateFile) {
+	r := &runner{path: path, state: state, stdout: os.Stdout}
+	if err := r.load(); err != nil {
+		fmt.Fprintln(os.Stderr, "gotail:", err)
+		os.Exit(1)
+	}
+	if !r.following() {
+		for _, in := range r.inputs {
+			in.wait()
+			in.close()
+		}
+		saveState(state)
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	var saves <-chan time.Time
+	if state != nil {
+		saves = time.Tick(state.interval)
+	}
+	rescan := time.NewTicker(r.rescan)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := r.load(); err != nil {
+					fmt.Fprintln(os.Stderr, "gotail: reload:", err)
+				}
+				// The rescan interval may have changed.
+				rescan.Stop()
+				rescan = time.NewTicker(r.rescan)
+				continue
+			}
+			rescan.Stop()
+			r.stop()
+			saveState(state)
+			return
+		case <-rescan.C:
+			r.scan()
+		case <-saves:
+			saveState(state)
+		}
+	}
+}
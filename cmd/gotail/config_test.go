@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForOutput waits for the file at path to hold expected.
+func waitForOutput(t *testing.T, path, expected string) {
+	var data []byte
+	for i := 0; i < 100; i++ {
+		data, _ = ioutil.ReadFile(path)
+		if string(data) == expected {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected output %q, got %q", expected, data)
+}
+
+func TestConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "gotail.json")
+	out := filepath.Join(dir, "out.log")
+	writeConfig := func(inputs ...string) {
+		config := fmt.Sprintf(`{"inputs": [%s]}`, strings.Join(inputs, ","))
+		if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputA := fmt.Sprintf(`{
+		"paths": [%q],
+		"from_start": true,
+		"exclude": "DEBUG",
+		"multiline": {"continue": "^\\s", "timeout": "50ms"},
+		"output": {"path": %q}
+	}`, filepath.Join(dir, "a*.log"), out)
+	inputB := fmt.Sprintf(`{"paths": [%q], "output": {"path": %q}}`,
+		filepath.Join(dir, "b.log"), out)
+
+	appendFile(t, filepath.Join(dir, "a.log"), "error\n  at main\nDEBUG\n")
+	writeConfig(inputA)
+	r := &runner{path: configPath, stdout: ioutil.Discard}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.stop()
+	waitForOutput(t, out, "error\n  at main\n")
+
+	// Reloading keeps input A running, and starts input B.
+	var a *input
+	for _, in := range r.inputs {
+		a = in
+	}
+	writeConfig(inputA, inputB)
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.inputs) != 2 || r.inputs[a.config.key()] != a {
+		t.Fatalf("expected input A to be kept, and input B to be added")
+	}
+	appendFile(t, filepath.Join(dir, "b.log"), "b\n")
+	waitForOutput(t, out, "error\n  at main\nb\n")
+
+	// Rescanning finds new files matching the glob.
+	appendFile(t, filepath.Join(dir, "a2.log"), "a2\n")
+	r.scan()
+	waitForOutput(t, out, "error\n  at main\nb\na2\n")
+
+	// An invalid config keeps the running inputs.
+	writeConfig(`{"paths": ["x"], "grep": "("}`)
+	if err := r.load(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(r.inputs) != 2 {
+		t.Fatalf("expected the running inputs to be kept")
+	}
+
+	// Removing input A stops its tails.
+	tails := a.running()
+	writeConfig(inputB)
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range tails {
+		select {
+		case <-it.done:
+		default:
+			t.Error("expected the tails of input A to be stopped")
+		}
+	}
+}
+
+func TestConfigRestartsEndedTails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out.log")
+	log := filepath.Join(dir, "a.log")
+	in, err := newInput(inputConfig{
+		Paths:        []string{log},
+		Poll:         true,
+		PollInterval: duration{10 * time.Millisecond},
+		FromStart:    true,
+		Output:       outputConfig{Path: out},
+	}, ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.stop()
+
+	appendFile(t, log, "first\n")
+	in.scan()
+	waitForOutput(t, out, "first\n")
+
+	// Without reopen, the tail ends once the file is deleted, and is
+	// started again by the next scan.
+	os.Remove(log)
+	for i := 0; len(in.running()) > 0; i++ {
+		if i == 100 {
+			t.Fatal("expected the tail to end")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	appendFile(t, log, "second\n")
+	in.scan()
+	waitForOutput(t, out, "first\nsecond\n")
+}
+
+func TestConfigStateAfterMultiline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "gotail.json")
+	out := filepath.Join(dir, "out.log")
+	log := filepath.Join(dir, "a.log")
+	config := fmt.Sprintf(`{"inputs": [{
+		"paths": [%q],
+		"from_start": true,
+		"multiline": {"start": "^\\S", "timeout": "1h"},
+		"output": {"path": %q}
+	}]}`, log, out)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := func() int64 {
+		state.mux.Lock()
+		defer state.mux.Unlock()
+		if st := state.Files[log]; st != nil {
+			return st.Offset
+		}
+		return 0
+	}
+
+	appendFile(t, log, "first\n  cont\nsecond\n")
+	r := &runner{path: configPath, state: state, stdout: ioutil.Discard}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	waitForOutput(t, out, "first\n  cont\n")
+
+	// The second record is not output yet, so it is not in the state.
+	time.Sleep(50 * time.Millisecond)
+	if n := offset(); n != 13 {
+		t.Errorf("expected the state past the first record at 13, got %d", n)
+	}
+	r.stop()
+	if n := offset(); n != 20 {
+		t.Errorf("expected the state past the second record at 20, got %d", n)
+	}
+}
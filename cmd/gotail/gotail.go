@@ -4,63 +4,379 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/hpcloud/tail"
 )
 
-func args2config() (tail.Config, int64) {
-	config := tail.Config{Follow: true}
-	n := int64(0)
+type options struct {
+	config     tail.Config
+	count      count // lines, or bytes with -c
+	bytes      bool
+	pid        int
+	retry      bool
+	headers    bool
+	state      *stateFile
+	configFile string
+
+	output, template, parse string
+}
+
+func args2config() options {
+	var opts options
+	var config tail.Config
+	lines, bytes := "10", ""
 	maxlinesize := int(0)
-	flag.Int64Var(&n, "n", 0, "tail from the last Nth location")
+	sleep := float64(1)
+	quiet, verbose := false, false
+	state, stateInterval := "", 5*time.Second
+	flag.StringVar(&lines, "n", lines, "output the last N lines, or use +N to output starting with line N")
+	flag.StringVar(&bytes, "c", bytes, "output the last N bytes, or use +N to output starting with byte N")
 	flag.IntVar(&maxlinesize, "max", 0, "max line size")
 	flag.BoolVar(&config.Follow, "f", false, "wait for additional data to be appended to the file")
-	flag.BoolVar(&config.ReOpen, "F", false, "follow, and track file rename/rotation")
+	flag.BoolVar(&config.ReOpen, "F", false, "follow, and track file rename/rotation (implies -retry)")
 	flag.BoolVar(&config.Poll, "p", false, "use polling, instead of inotify")
-	flag.Parse()
+	flag.Float64Var(&sleep, "s", sleep, "with -p, sleep for about N seconds between polls")
+	flag.IntVar(&opts.pid, "pid", 0, "with -f, terminate after process PID dies")
+	flag.BoolVar(&opts.retry, "retry", false, "keep trying to open a file if it is inaccessible")
+	flag.BoolVar(&quiet, "q", false, "never output headers giving file names")
+	flag.BoolVar(&verbose, "v", false, "always output headers giving file names")
+	flag.StringVar(&opts.output, "output", "text", "output format: text, json, ndjson or template")
+	flag.StringVar(&opts.template, "template", "", "with -output template, Go text/template applied to each record")
+	flag.StringVar(&opts.parse, "parse", "none", "parse fields from lines: none, json, logfmt or regexp:EXPR (named groups)")
+	flag.StringVar(&opts.configFile, "config", "", "tail the inputs described in a JSON config file, reloaded on SIGHUP")
+	flag.StringVar(&state, "state", "", "record the position of each file in FILE, and resume from it")
+	flag.DurationVar(&stateInterval, "state-interval", stateInterval, "with -state, how often to save positions")
+	flag.CommandLine.Parse(splitShortArgs(os.Args[1:]))
+
+	var err error
+	if opts.count, err = parseCount(lines); err != nil {
+		fmt.Fprintln(os.Stderr, "gotail:", err)
+		os.Exit(1)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "c":
+			opts.bytes = true
+			if opts.count, err = parseCount(bytes); err != nil {
+				fmt.Fprintln(os.Stderr, "gotail:", err)
+				os.Exit(1)
+			}
+		case "s":
+			config.PollInterval = time.Duration(sleep * float64(time.Second))
+		}
+	})
+
 	if config.ReOpen {
 		config.Follow = true
+		opts.retry = true
+	}
+	if state != "" {
+		if opts.state, err = loadState(state); err != nil {
+			fmt.Fprintln(os.Stderr, "gotail:", err)
+			os.Exit(1)
+		}
+		opts.state.interval = stateInterval
 	}
+	config.MustExist = !opts.retry
 	config.MaxLineSize = maxlinesize
-	return config, n
+	config.Logger = tail.DiscardingLogger
+	opts.config = config
+	opts.headers = verbose || (flag.NArg() > 1 && !quiet)
+	return opts
+}
+
+// splitShortArgs turns "-n5" and "-c+5" into "-n 5" and "-c +5", as
+// accepted by GNU tail.
+func splitShortArgs(args []string) []string {
+	var split []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(split, args[i:]...)
+		}
+		if len(arg) > 2 && (arg[:2] == "-n" || arg[:2] == "-c") && arg[2] != '=' {
+			split = append(split, arg[:2], arg[2:])
+			continue
+		}
+		split = append(split, arg)
+	}
+	return split
 }
 
 func main() {
-	config, n := args2config()
-	if flag.NFlag() < 1 {
-		fmt.Println("need one or more files as arguments")
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
+	opts := args2config()
+	if opts.configFile != "" {
+		runConfig(opts.configFile, opts.state)
+		return
+	}
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	out, err := newPrinter(os.Stdout, opts.output, opts.template, opts.parse, opts.headers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gotail:", err)
 		os.Exit(1)
 	}
+	tails := &tailSet{}
+	if opts.pid != 0 && opts.config.Follow {
+		interval := opts.config.PollInterval
+		if interval == 0 {
+			interval = time.Second
+		}
+		go func() {
+			waitPid(opts.pid, interval)
+			tails.stopAll((*tail.Tail).StopAtEOF)
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		tails.stopAll((*tail.Tail).Stop)
+	}()
+	if opts.state != nil {
+		go func() {
+			for _ = range time.Tick(opts.state.interval) {
+				saveState(opts.state)
+			}
+		}()
+	}
 
-	if n != 0 {
-		config.Location = &tail.SeekInfo{-n, os.SEEK_END}
+	failed := false
+	if opts.config.Follow {
+		done := make(chan bool)
+		for _, filename := range files {
+			go func(filename string) {
+				done <- tailFile(filename, opts, out, tails)
+			}(filename)
+		}
+		for _ = range files {
+			if !<-done {
+				failed = true
+			}
+		}
+	} else {
+		// Output files one after the other.
+		for _, filename := range files {
+			if !tailFile(filename, opts, out, tails) {
+				failed = true
+			}
+		}
+	}
+	if !saveState(opts.state) {
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
 	}
+}
 
-	done := make(chan bool)
-	for _, filename := range flag.Args() {
-		go tailFile(filename, config, done)
+// tailFile outputs the lines of filename, and returns false on error.
+func tailFile(filename string, opts options, out *printer, tails *tailSet) bool {
+	name := filename
+	var t *tail.Tail
+	var err error
+	if filename == "-" {
+		name = "standard input"
+		t, err = tailStdin(opts)
+	} else {
+		config := opts.config
+		if opts.state != nil && opts.state.has(filename) {
+			config.Location = opts.state.resume(filename, func(rotated string, offset int64) {
+				catchUp(rotated, name, offset, opts, out)
+			})
+		} else {
+			config.Location, err = location(filename, opts)
+		}
+		if err == nil {
+			t, err = tail.TailFile(filename, config)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", name, err)
+		return false
+	}
+	tails.add(t)
+	out.header(name)
+
+	// With +N lines, skip the first N-1 lines of stdin.
+	skip := int64(0)
+	if filename == "-" && opts.count.fromStart && !opts.bytes {
+		skip = opts.count.n - 1
+	}
+	for line := range t.Lines {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		printLine(name, line, out)
+		if opts.state != nil && filename != "-" {
+			opts.state.update(filename, line)
+		}
 	}
+	// Stopping at EOF on -pid reports an error, which is expected.
+	if err = t.Wait(); err != nil && !tails.isStopped() {
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", name, err)
+		return false
+	}
+	return true
+}
 
-	for _, _ = range flag.Args() {
-		<-done
+func printLine(name string, line *tail.Line, out *printer) {
+	err := out.print(&record{
+		File:   name,
+		Offset: line.Offset,
+		Time:   line.Time,
+		Text:   line.Text,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", name, err)
 	}
 }
 
-func tailFile(filename string, config tail.Config, done chan bool) {
-	defer func() { done <- true }()
-	t, err := tail.TailFile(filename, config)
+// catchUp outputs the rest of a file rotated while gotail was not
+// running, from the offset recorded in the state file.
+func catchUp(rotated, name string, offset int64, opts options, out *printer) {
+	t, err := tail.TailFile(rotated, tail.Config{
+		Location:    &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET},
+		MaxLineSize: opts.config.MaxLineSize,
+		Logger:      tail.DiscardingLogger,
+	})
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", rotated, err)
 		return
 	}
 	for line := range t.Lines {
-		fmt.Println(line.Text)
+		printLine(name, line, out)
+	}
+	if err = t.Wait(); err != nil {
+		fmt.Fprintf(os.Stderr, "gotail: %s: %s\n", rotated, err)
+	}
+}
+
+// location returns where to start reading filename from, or nil if it
+// does not exist yet.
+func location(filename string, opts options) (*tail.SeekInfo, error) {
+	if opts.count.fromStart {
+		offset := opts.count.n - 1
+		if offset <= 0 {
+			return nil, nil
+		}
+		if !opts.bytes {
+			f, err := os.Open(filename)
+			if os.IsNotExist(err) && opts.retry {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			if offset, err = lineOffset(f, opts.count.n); err != nil {
+				return nil, err
+			}
+		}
+		return &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}, nil
+	}
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) && opts.retry {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
-	err = t.Wait()
+	defer f.Close()
+	fi, err := f.Stat()
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	offset := fi.Size() - opts.count.n
+	if offset < 0 {
+		offset = 0
+	}
+	if !opts.bytes {
+		if offset, err = lastLinesOffset(f, fi.Size(), opts.count.n); err != nil {
+			return nil, err
+		}
+	}
+	return &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}, nil
+}
+
+// tailStdin tails the standard input, which cannot be seeked. It is
+// streamed when starting from a given line or byte, and otherwise read
+// entirely to output its end.
+func tailStdin(opts options) (*tail.Tail, error) {
+	if opts.count.fromStart {
+		var r io.Reader = os.Stdin
+		if opts.bytes && opts.count.n > 1 {
+			if _, err := io.CopyN(ioutil.Discard, r, opts.count.n-1); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		return tail.TailReader(r, opts.config)
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	offset := int64(len(data)) - opts.count.n
+	if offset < 0 {
+		offset = 0
+	}
+	if !opts.bytes {
+		offset, _ = lastLinesOffset(bytes.NewReader(data), int64(len(data)), opts.count.n)
+	}
+	return tail.TailReader(bytes.NewReader(data[offset:]), opts.config)
+}
+
+// tailSet holds the running tails, to stop them all with -pid or on
+// interrupt.
+type tailSet struct {
+	mux   sync.Mutex
+	tails []*tail.Tail
+	stop  func(*tail.Tail) error
+}
+
+func (s *tailSet) add(t *tail.Tail) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.tails = append(s.tails, t)
+	if s.stop != nil {
+		go s.stop(t)
+	}
+}
+
+func (s *tailSet) isStopped() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stop != nil
+}
+
+// stopAll stops the tails with stop, which is either Stop or
+// StopAtEOF. Tails added later are stopped as well.
+func (s *tailSet) stopAll(stop func(*tail.Tail) error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = stop
+	for _, t := range s.tails {
+		go stop(t)
 	}
 }
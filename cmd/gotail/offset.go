@@ -0,0 +1,108 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// count is the argument of -n and -c: the number of lines or bytes
+// to output from the end, or, with a leading '+', the line or byte to
+// start from.
+type count struct {
+	n         int64
+	fromStart bool
+}
+
+var countSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"b", 512}, {"K", 1024}, {"M", 1024 * 1024}, {"G", 1024 * 1024 * 1024},
+}
+
+// parseCount parses "N", "-N" or "+N", with an optional multiplier
+// suffix as in GNU tail (b, K, KB, M, MB, G, GB).
+func parseCount(s string) (count, error) {
+	var c count
+	orig := s
+	if strings.HasPrefix(s, "+") {
+		c.fromStart = true
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "-")
+	}
+	multiplier := int64(1)
+	for _, suffix := range countSuffixes {
+		if strings.HasSuffix(s, suffix.suffix) {
+			s = strings.TrimSuffix(s, suffix.suffix)
+			multiplier = suffix.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return c, fmt.Errorf("invalid number: %q", orig)
+	}
+	c.n = n * multiplier
+	return c, nil
+}
+
+// lastLinesOffset returns the offset of the nth line before the end of
+// r, which is size bytes long.
+func lastLinesOffset(r io.ReaderAt, size int64, n int64) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	buf := make([]byte, 4096)
+	pos := size
+	for pos > 0 {
+		chunk := int64(len(buf))
+		if pos < chunk {
+			chunk = pos
+		}
+		pos -= chunk
+		if _, err := r.ReadAt(buf[:chunk], pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			// A final newline ends the last line rather than
+			// starting a new one.
+			if buf[i] != '\n' || pos+i == size-1 {
+				continue
+			}
+			n--
+			if n == 0 {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// lineOffset returns the offset of the nth line (counting from 1) of r,
+// or the length of r if it has fewer lines.
+func lineOffset(r io.Reader, n int64) (int64, error) {
+	var offset int64
+	br := bufio.NewReader(r)
+	for ; n > 1; n-- {
+		line, err := br.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			offset += int64(len(line))
+			line, err = br.ReadSlice('\n')
+		}
+		offset += int64(len(line))
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCount(t *testing.T) {
+	for s, expected := range map[string]count{
+		"10":  {10, false},
+		"-10": {10, false},
+		"+10": {10, true},
+		"0":   {0, false},
+		"2K":  {2048, false},
+		"+1b": {512, true},
+		"3KB": {3000, false},
+	} {
+		c, err := parseCount(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+		} else if c != expected {
+			t.Errorf("%q: expected %+v, got %+v", s, expected, c)
+		}
+	}
+	for _, s := range []string{"", "+", "ten", "1X", "--1"} {
+		if _, err := parseCount(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		n        int64
+		expected int64
+	}{
+		{"a\nb\nc\n", 2, 2},
+		{"a\nb\nc", 2, 2},
+		{"a\nb\nc\n", 3, 0},
+		{"a\nb\nc\n", 10, 0},
+		{"a\nb\nc\n", 0, 6},
+		{"", 1, 0},
+		{"\n\n\n", 1, 2},
+		{strings.Repeat("x", 5000) + "\n" + strings.Repeat("y", 5000) + "\n", 1, 5001},
+	} {
+		r := strings.NewReader(test.content)
+		offset, err := lastLinesOffset(r, int64(len(test.content)), test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != test.expected {
+			t.Errorf("last %d lines of %.10q: expected offset %d, got %d",
+				test.n, test.content, test.expected, offset)
+		}
+	}
+}
+
+func TestLineOffset(t *testing.T) {
+	for _, test := range []struct {
+		content  string
+		n        int64
+		expected int64
+	}{
+		{"a\nb\nc\n", 1, 0},
+		{"a\nb\nc\n", 2, 2},
+		{"a\nb\nc\n", 4, 6},
+		{"a\nb\nc", 10, 5},
+		{strings.Repeat("x", 5000) + "\nyy\n", 2, 5001},
+	} {
+		offset, err := lineOffset(strings.NewReader(test.content), test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != test.expected {
+			t.Errorf("line %d of %.10q: expected offset %d, got %d",
+				test.n, test.content, test.expected, offset)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// record is a line of output, as formatted by -output.
+type record struct {
+	Input  string                 `json:"input,omitempty"`
+	File   string                 `json:"file"`
+	Offset int64                  `json:"offset"`
+	Time   time.Time              `json:"time"`
+	Text   string                 `json:"text"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// printer writes records from all tailed files. In text output, a
+// "==> name <==" header precedes the lines of each file when headers
+// is set.
+type printer struct {
+	mux     sync.Mutex
+	w       io.Writer
+	format  func(io.Writer, *record) error
+	parse   func(string) map[string]interface{}
+	headers bool
+	last    string
+	started bool
+}
+
+// newPrinter returns a printer writing to w in the given output format
+// (text, json, ndjson or template), parsing fields from lines with the
+// given parser (none, json, logfmt or regexp:EXPR).
+func newPrinter(w io.Writer, output, tmpl, parser string, headers bool) (*printer, error) {
+	p := &printer{w: w}
+	switch output {
+	case "text", "":
+		p.format = formatText
+		p.headers = headers
+	case "json":
+		p.format = formatJSON("  ")
+	case "ndjson":
+		p.format = formatJSON("")
+	case "template":
+		if tmpl == "" {
+			return nil, fmt.Errorf("-output template requires -template")
+		}
+		t, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		p.format = func(w io.Writer, rec *record) error {
+			if err := t.Execute(w, rec); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format %q", output)
+	}
+
+	switch {
+	case parser == "" || parser == "none":
+	case parser == "json":
+		p.parse = parseJSON
+	case parser == "logfmt":
+		p.parse = parseLogfmt
+	case strings.HasPrefix(parser, "regexp:"):
+		re, err := regexp.Compile(strings.TrimPrefix(parser, "regexp:"))
+		if err != nil {
+			return nil, err
+		}
+		p.parse = regexpParser(re)
+	default:
+		return nil, fmt.Errorf("unknown parser %q", parser)
+	}
+	return p, nil
+}
+
+func (p *printer) print(rec *record) error {
+	if p.parse != nil {
+		rec.Fields = p.parse(rec.Text)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.writeHeader(rec.File)
+	return p.format(p.w, rec)
+}
+
+// header writes the header of file once it is opened, so that files
+// without lines get one too.
+func (p *printer) header(file string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.writeHeader(file)
+}
+
+// writeHeader writes the header of file, with headers, unless it was
+// the last one written. mux must be held.
+func (p *printer) writeHeader(file string) {
+	if p.headers && (!p.started || file != p.last) {
+		if p.started {
+			fmt.Fprintln(p.w)
+		}
+		fmt.Fprintf(p.w, "==> %s <==\n", file)
+	}
+	p.started = true
+	p.last = file
+}
+
+func formatText(w io.Writer, rec *record) error {
+	_, err := fmt.Fprintln(w, rec.Text)
+	return err
+}
+
+// formatJSON returns a format writing each record as a JSON object,
+// on a single line when indent is empty.
+func formatJSON(indent string) func(io.Writer, *record) error {
+	return func(w io.Writer, rec *record) error {
+		var b []byte
+		var err error
+		if indent == "" {
+			b, err = json.Marshal(rec)
+		} else {
+			b, err = json.MarshalIndent(rec, "", indent)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+}
+
+// parseJSON returns the members of a line holding a JSON object.
+func parseJSON(text string) map[string]interface{} {
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(text), &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+// parseLogfmt returns the key=value pairs of a line, where values may
+// be double-quoted. Keys without a value are set to true.
+func parseLogfmt(text string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for i := 0; i < len(text); {
+		if text[i] == ' ' || text[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' && text[i] != '\t' {
+			i++
+		}
+		key := text[start:i]
+		if i >= len(text) || text[i] != '=' {
+			fields[key] = true
+			continue
+		}
+		i++ // '='
+		if i < len(text) && text[i] == '"' {
+			var value []byte
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				value = append(value, text[i])
+			}
+			i++ // closing '"'
+			fields[key] = string(value)
+			continue
+		}
+		start = i
+		for i < len(text) && text[i] != ' ' && text[i] != '\t' {
+			i++
+		}
+		fields[key] = text[start:i]
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// regexpParser returns a parser setting the named groups of re.
+func regexpParser(re *regexp.Regexp) func(string) map[string]interface{} {
+	names := re.SubexpNames()
+	return func(text string) map[string]interface{} {
+		match := re.FindStringSubmatch(text)
+		if match == nil {
+			return nil
+		}
+		fields := make(map[string]interface{})
+		for i, name := range names {
+			if name != "" {
+				fields[name] = match[i]
+			}
+		}
+		return fields
+	}
+}
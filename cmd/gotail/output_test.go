@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	fields := parseLogfmt(`level=info msg="hello \"world\"" took=3ms  debug`)
+	expected := map[string]interface{}{
+		"level": "info",
+		"msg":   `hello "world"`,
+		"took":  "3ms",
+		"debug": true,
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+	if fields := parseLogfmt("   "); fields != nil {
+		t.Errorf("expected no fields, got %v", fields)
+	}
+}
+
+func TestPrinterFormats(t *testing.T) {
+	rec := func() *record {
+		return &record{
+			File:   "app.log",
+			Offset: 42,
+			Time:   time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC),
+			Text:   `{"level":"warn"}`,
+		}
+	}
+	for _, test := range []struct {
+		output, template, parse string
+		expected                string
+	}{
+		{"text", "", "", "==> app.log <==\n{\"level\":\"warn\"}\n"},
+		{"ndjson", "", "json", `{"file":"app.log","offset":42,"time":"2016-04-01T12:00:00Z","text":"{\"level\":\"warn\"}","fields":{"level":"warn"}}` + "\n"},
+		{"template", "{{.File}}:{{.Offset}} {{.Fields.level}}", "json", "app.log:42 warn\n"},
+		{"template", "{{.Fields.lvl}}", `regexp:"level":"(?P<lvl>\w+)"`, "warn\n"},
+	} {
+		var buf bytes.Buffer
+		p, err := newPrinter(&buf, test.output, test.template, test.parse, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.print(rec()); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.output, test.expected, buf.String())
+		}
+	}
+
+	if _, err := newPrinter(&bytes.Buffer{}, "xml", "", "", false); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := newPrinter(&bytes.Buffer{}, "template", "", "", false); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestPrinterHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := newPrinter(&buf, "text", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.header("empty.log")
+	p.header("app.log")
+	p.print(&record{File: "app.log", Text: "hello"})
+	expected := "==> empty.log <==\n\n==> app.log <==\nhello\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,19 @@
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// waitPid returns once process pid has exited, checking every interval.
+func waitPid(pid int, interval time.Duration) {
+	for {
+		// EPERM means the process exists but is not ours.
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
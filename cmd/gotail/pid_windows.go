@@ -0,0 +1,17 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// waitPid returns once process pid has exited.
+func waitPid(pid int, interval time.Duration) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return
+	}
+	p.Wait()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hpcloud/tail"
+)
+
+const serveUsage = `usage: gotail serve [flags] file...
+
+Streams the lines of the given files over HTTP:
+
+  GET /                     lists the files, as JSON
+  GET /tail?file=NAME       streams the lines of file NAME, as chunked
+                            text/plain, or as Server-Sent Events with
+                            format=sse or "Accept: text/event-stream"
+
+/tail accepts these query parameters:
+
+  n=N, n=+N        start with the last N lines, or with line N (default 10)
+  c=N, c=+N        start with the last N bytes, or with byte N
+  offset=N         start at byte offset N
+  grep=REGEXP      only send lines matching REGEXP
+  exclude=REGEXP   do not send lines matching REGEXP
+
+Each Server-Sent Event has the offset just past its line as id: a client
+reconnecting with a Last-Event-ID header resumes at that offset, instead
+of at the location given by n, c or offset.
+
+flags:
+`
+
+// serve runs "gotail serve".
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, serveUsage)
+		flags.PrintDefaults()
+	}
+	addr := flags.String("addr", ":8080", "address to listen on")
+	poll := flags.Bool("p", false, "use polling, instead of inotify")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	config := tail.Config{
+		Follow: true,
+		ReOpen: true,
+		Poll:   *poll,
+		Logger: tail.DiscardingLogger,
+	}
+	log.Printf("Serving %d files on %s", flags.NArg(), *addr)
+	log.Fatal(http.ListenAndServe(*addr, newServer(flags.Args(), config)))
+}
+
+// server streams the lines of a fixed set of files, tailing each of
+// them anew for every client.
+type server struct {
+	files  map[string]bool
+	names  []string
+	config tail.Config
+}
+
+func newServer(files []string, config tail.Config) http.Handler {
+	s := &server{files: make(map[string]bool), config: config}
+	for _, f := range files {
+		if !s.files[f] {
+			s.files[f] = true
+			s.names = append(s.names, f)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.list)
+	mux.HandleFunc("/tail", s.stream)
+	return mux
+}
+
+func (s *server) list(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	type file struct {
+		File string `json:"file"`
+		URL  string `json:"url"`
+	}
+	files := make([]file, 0, len(s.names))
+	for _, name := range s.names {
+		files = append(files, file{name, "/tail?file=" + url.QueryEscape(name)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func (s *server) stream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filename := q.Get("file")
+	if !s.files[filename] {
+		http.Error(w, "unknown file", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	match, err := lineFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	config := s.config
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		q.Set("offset", id)
+	}
+	if config.Location, err = queryLocation(filename, q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := tail.TailFile(filename, config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		// Drain the lines so that Stop does not block.
+		go func() {
+			for _ = range t.Lines {
+			}
+		}()
+		t.Stop()
+	}()
+
+	sse := q.Get("format") == "sse" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case line, ok := <-t.Lines:
+			if !ok {
+				return
+			}
+			if line.Err != nil || !match(line.Text) {
+				continue
+			}
+			if sse {
+				_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.End, line.Text)
+			} else {
+				_, err = fmt.Fprintln(w, line.Text)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// lineFilter returns the filter given by the grep and exclude query
+// parameters.
+func lineFilter(q url.Values) (func(string) bool, error) {
+	return newLineFilter(q.Get("grep"), q.Get("exclude"))
+}
+
+// newLineFilter returns a filter keeping lines that match grep, unless
+// they match exclude. Either regexp may be empty.
+func newLineFilter(grepExpr, excludeExpr string) (func(string) bool, error) {
+	var grep, exclude *regexp.Regexp
+	var err error
+	if grepExpr != "" {
+		if grep, err = regexp.Compile(grepExpr); err != nil {
+			return nil, fmt.Errorf("invalid grep: %s", err)
+		}
+	}
+	if excludeExpr != "" {
+		if exclude, err = regexp.Compile(excludeExpr); err != nil {
+			return nil, fmt.Errorf("invalid exclude: %s", err)
+		}
+	}
+	return func(text string) bool {
+		return (grep == nil || grep.MatchString(text)) &&
+			(exclude == nil || !exclude.MatchString(text))
+	}, nil
+}
+
+// queryLocation returns where to start tailing from, given by the
+// offset, c or n query parameters.
+func queryLocation(filename string, q url.Values) (*tail.SeekInfo, error) {
+	if s := q.Get("offset"); s != "" {
+		offset, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %q", s)
+		}
+		return &tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}, nil
+	}
+
+	opts := options{retry: true}
+	var err error
+	if s := q.Get("c"); s != "" {
+		opts.bytes = true
+		opts.count, err = parseCount(s)
+	} else if s := q.Get("n"); s != "" {
+		opts.count, err = parseCount(s)
+	} else {
+		opts.count = count{n: 10}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return location(filename, opts)
+}
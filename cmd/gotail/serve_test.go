@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+func newTestServer(t *testing.T, content string) (*httptest.Server, string, func()) {
+	dir, err := ioutil.TempDir("", "gotail-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newServer([]string{filename}, tail.Config{
+		Follow: true,
+		ReOpen: true,
+		Logger: tail.DiscardingLogger,
+	}))
+	return server, filename, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func get(t *testing.T, u string, header http.Header) (*http.Response, *bufio.Reader) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func expectLines(t *testing.T, r *bufio.Reader, lines ...string) {
+	for _, want := range lines {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected %q, got error %v", want, err)
+		}
+		if got = strings.TrimSuffix(got, "\n"); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+// appendFile appends data to filename, creating it if needed.
+func appendFile(t *testing.T, filename, data string) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServePlain(t *testing.T) {
+	server, filename, cleanup := newTestServer(t, "one\ntwo\nthree\n")
+	defer cleanup()
+
+	resp, body := get(t, server.URL+"/tail?n=2&exclude=^x&file="+url.QueryEscape(filename), nil)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	expectLines(t, body, "two", "three")
+
+	<-time.After(100 * time.Millisecond)
+	appendFile(t, filename, "xfiltered\nfour\n")
+	expectLines(t, body, "four")
+}
+
+func TestServeSSE(t *testing.T) {
+	server, filename, cleanup := newTestServer(t, "one\ntwo\nthree\n")
+	defer cleanup()
+
+	resp, body := get(t, server.URL+"/tail?offset=4&grep=t&file="+url.QueryEscape(filename),
+		http.Header{"Accept": {"text/event-stream"}})
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	expectLines(t, body, "id: 8", "data: two", "", "id: 14", "data: three", "")
+}
+
+func TestServeSSELastEventID(t *testing.T) {
+	server, filename, cleanup := newTestServer(t, "one\ntwo\nthree\n")
+	defer cleanup()
+
+	// The reconnecting client resumes after the last event it received,
+	// whatever the query asks for.
+	resp, body := get(t, server.URL+"/tail?format=sse&n=3&file="+url.QueryEscape(filename),
+		http.Header{"Last-Event-ID": {"8"}})
+	defer resp.Body.Close()
+	expectLines(t, body, "id: 14", "data: three", "")
+
+	resp, _ = get(t, server.URL+"/tail?format=sse&file="+url.QueryEscape(filename),
+		http.Header{"Last-Event-ID": {"nope"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d for an invalid Last-Event-ID, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestServeUnknownFile(t *testing.T) {
+	server, _, cleanup := newTestServer(t, "")
+	defer cleanup()
+
+	resp, _ := get(t, server.URL+"/tail?file=/etc/passwd", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %s", resp.Status)
+	}
+}
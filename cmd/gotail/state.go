@@ -0,0 +1,203 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// fingerprintSize is how many leading bytes of a file are hashed to
+// recognise it, in addition to its device and inode.
+const fingerprintSize = 1024
+
+// fileState is the position reached in a tailed file, and what is
+// needed to recognise that file after a restart.
+type fileState struct {
+	ID              string `json:"id,omitempty"`
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+}
+
+// stateFile records the position of every tailed file, for -state.
+type stateFile struct {
+	path     string
+	interval time.Duration
+	mux      sync.Mutex
+	Files    map[string]*fileState `json:"files"`
+}
+
+// loadState reads the state file at path, if it exists.
+func loadState(path string) (*stateFile, error) {
+	s := &stateFile{path: path, Files: make(map[string]*fileState)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*fileState)
+	}
+	return s, nil
+}
+
+// save atomically replaces the state file.
+func (s *stateFile) save() error {
+	s.mux.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// saveState saves s, if any, reporting errors.
+func saveState(s *stateFile) bool {
+	if s == nil {
+		return true
+	}
+	if err := s.save(); err != nil {
+		fmt.Fprintln(os.Stderr, "gotail:", err)
+		return false
+	}
+	return true
+}
+
+// has returns whether the state holds a position for filename.
+func (s *stateFile) has(filename string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.Files[filename] != nil
+}
+
+// update records that line of filename was output.
+func (s *stateFile) update(filename string, line *tail.Line) {
+	// Update a copy, as save may run meanwhile.
+	var st fileState
+	s.mux.Lock()
+	prev := s.Files[filename]
+	if prev != nil {
+		st = *prev
+	}
+	s.mux.Unlock()
+
+	if prev == nil || line.Offset < st.Offset {
+		// First line of a new, rotated or truncated file.
+		st = fileState{}
+		if fi, err := os.Stat(filename); err == nil {
+			st.ID = fileID(fi)
+		}
+	}
+	if st.FingerprintSize < fingerprintSize && line.End > st.FingerprintSize {
+		// Hash more of the file while it is short.
+		st.Fingerprint, st.FingerprintSize, _ = fingerprint(filename, fingerprintSize)
+	}
+	st.Offset = line.End
+
+	s.mux.Lock()
+	s.Files[filename] = &st
+	s.mux.Unlock()
+}
+
+// resume returns where to resume tailing filename. When filename was
+// rotated since the state was saved, and the previous file is found
+// next to it, catchUp is called to output the rest of that file.
+// Tailing then starts with the beginning of the new file, as it does
+// after a truncation.
+func (s *stateFile) resume(filename string, catchUp func(rotated string, offset int64)) *tail.SeekInfo {
+	s.mux.Lock()
+	st := s.Files[filename]
+	s.mux.Unlock()
+	if st == nil {
+		return nil
+	}
+
+	if fi, err := os.Stat(filename); err == nil && st.matches(filename, fi) {
+		if fi.Size() >= st.Offset {
+			return &tail.SeekInfo{Offset: st.Offset, Whence: os.SEEK_SET}
+		}
+	} else if rotated := st.findRotated(filename); rotated != "" {
+		catchUp(rotated, st.Offset)
+	}
+
+	s.mux.Lock()
+	delete(s.Files, filename)
+	s.mux.Unlock()
+	return nil
+}
+
+// matches returns whether the file at path, of the given FileInfo, is
+// the one st was recorded for.
+func (st *fileState) matches(path string, fi os.FileInfo) bool {
+	if st.ID != "" && fileID(fi) != st.ID {
+		return false
+	}
+	fp, size, err := fingerprint(path, st.FingerprintSize)
+	return err == nil && size == st.FingerprintSize && fp == st.Fingerprint
+}
+
+// findRotated looks for the file st was recorded for in the directory
+// of filename, as renamed by log rotation.
+func (st *fileState) findRotated(filename string) string {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, fi := range infos {
+		if fi.Name() == base || !fi.Mode().IsRegular() {
+			continue
+		}
+		// Without file IDs, only consider names like base.1
+		// rather than fingerprinting the whole directory.
+		if st.ID == "" && !strings.HasPrefix(fi.Name(), base) {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		if st.matches(path, fi) {
+			return path
+		}
+	}
+	return ""
+}
+
+// fingerprint hashes the first max bytes of the file at path, and
+// returns how many bytes were hashed.
+func fingerprint(path string, max int64) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha1.New()
+	n, err := io.CopyN(h, f, max)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
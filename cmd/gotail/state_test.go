@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcloud/tail"
+)
+
+// readState records that all lines of filename, tailed with config,
+// were output, and returns the state as reloaded from disk.
+func readState(t *testing.T, dir, filename string, config tail.Config) *stateFile {
+	s, err := loadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Logger = tail.DiscardingLogger
+	tl, err := tail.TailFile(filename, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line := range tl.Lines {
+		s.update(filename, line)
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = loadState(s.path); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStateResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.log")
+	noCatchUp := func(string, int64) { t.Error("unexpected catch up") }
+
+	ioutil.WriteFile(filename, []byte("hello\nworld\n"), 0600)
+	s := readState(t, dir, filename, tail.Config{})
+	if loc := s.resume(filename, noCatchUp); loc == nil || loc.Offset != 12 {
+		t.Errorf("expected to resume at 12, got %+v", loc)
+	}
+
+	// Truncated.
+	s = readState(t, dir, filename, tail.Config{})
+	ioutil.WriteFile(filename, []byte("hello\n"), 0600)
+	if loc := s.resume(filename, noCatchUp); loc != nil {
+		t.Errorf("expected to start over after truncation, got %+v", loc)
+	}
+
+	// Rotated, with lines added to the old file before the rename.
+	ioutil.WriteFile(filename, []byte("hello\nworld\n"), 0600)
+	s = readState(t, dir, filename, tail.Config{})
+	f, _ := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("again\n")
+	f.Close()
+	os.Rename(filename, filename+".1")
+	ioutil.WriteFile(filename, []byte("new\n"), 0600)
+	var rotated string
+	var offset int64
+	loc := s.resume(filename, func(r string, o int64) { rotated, offset = r, o })
+	if loc != nil {
+		t.Errorf("expected to start the new file over, got %+v", loc)
+	}
+	if rotated != filename+".1" || offset != 12 {
+		t.Errorf("expected to catch up with %s at 12, got %q at %d", filename+".1", rotated, offset)
+	}
+}
+
+func TestStateResumeAfterSplitLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.log")
+	noCatchUp := func(string, int64) { t.Error("unexpected catch up") }
+
+	// A line of exactly twice MaxLineSize, then one without newline.
+	ioutil.WriteFile(filename, []byte("abcdef\nend"), 0600)
+	s := readState(t, dir, filename, tail.Config{MaxLineSize: 3})
+	if loc := s.resume(filename, noCatchUp); loc == nil || loc.Offset != 10 {
+		t.Errorf("expected to resume at 10, got %+v", loc)
+	}
+
+	ioutil.WriteFile(filename, []byte("abcdef\n"), 0600)
+	s = readState(t, dir, filename, tail.Config{MaxLineSize: 3})
+	if loc := s.resume(filename, noCatchUp); loc == nil || loc.Offset != 7 {
+		t.Errorf("expected to resume at 7, got %+v", loc)
+	}
+}
@@ -0,0 +1,13 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// fileID is not available on Windows, where files are recognised by
+// their fingerprint only.
+func fileID(fi os.FileInfo) string {
+	return ""
+}
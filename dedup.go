@@ -0,0 +1,89 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import "time"
+
+// DEFAULT_DEDUP_WINDOW is the default Dedup.MaxWindow.
+var DEFAULT_DEDUP_WINDOW = time.Second
+
+// Dedup collapses runs of consecutive identical lines, such as those of
+// a crash-looping service, into their first Line, whose Repeats counts
+// the others.
+type Dedup struct {
+	// Normalize, when set, returns what lines are compared by, eg:
+	// their text without the timestamp or request id.
+	Normalize func(line string) string
+
+	// MaxWindow is how long a run is held back at most before being
+	// sent, even if it goes on: the next repeats start a new run.
+	// Defaults to DEFAULT_DEDUP_WINDOW.
+	MaxWindow time.Duration
+}
+
+func (d *Dedup) key(line string) string {
+	if d.Normalize != nil {
+		return d.Normalize(line)
+	}
+	return line
+}
+
+func (d *Dedup) window() time.Duration {
+	if d.MaxWindow > 0 {
+		return d.MaxWindow
+	}
+	return DEFAULT_DEDUP_WINDOW
+}
+
+// emit sends line to Lines, or holds it back with Dedup until the run
+// of its repeats ends. end is the position past line. It returns false
+// if a line was dropped by Seek or Stop.
+func (tail *Tail) emit(line *Line, end int64) bool {
+	if tail.Dedup == nil {
+		return tail.deliver(line, end)
+	}
+	key := tail.Dedup.key(line.Text)
+	if tail.held != nil && key == tail.heldKey {
+		tail.held.Repeats++
+		tail.held.LastTime = line.Time
+		tail.heldEnd = end
+		if line.Time.Sub(tail.held.Time) >= tail.Dedup.window() {
+			return tail.flush()
+		}
+		return true
+	}
+	if !tail.flush() {
+		return false
+	}
+	tail.held, tail.heldKey, tail.heldEnd = line, key, end
+	return true
+}
+
+// flush sends the held line, if any.
+func (tail *Tail) flush() bool {
+	if tail.held == nil {
+		return true
+	}
+	line := tail.held
+	tail.held = nil
+	return tail.deliver(line, tail.heldEnd)
+}
+
+// flushTimeout returns a channel receiving when the held line is due,
+// or nil without one.
+func (tail *Tail) flushTimeout() <-chan time.Time {
+	if tail.held == nil {
+		return nil
+	}
+	return time.After(tail.Dedup.window() - time.Since(tail.held.Time))
+}
+
+// flushAtEnd sends the held line once tailing ends, unless stopped by
+// Stop, after which Lines may no longer be received from. Err is nil
+// only then: it is tomb.ErrStillAlive at EOF, or the error killing the
+// tail.
+func (tail *Tail) flushAtEnd() {
+	if tail.Err() != nil {
+		tail.flush()
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// Package httpfs implements a vfs.FS tailing files served over HTTP,
+// using range requests to fetch only what was appended.
+//
+//	t, err := tail.TailFile("http://host/var/log/app.log", tail.Config{
+//		Follow:       true,
+//		ReOpen:       true,
+//		FS:           httpfs.New(nil),
+//		PollInterval: 2 * time.Second,
+//	})
+//
+// The server is polled at Config.PollInterval. A file is considered
+// truncated when its size shrinks below the read position, and, with
+// RotationByETag, replaced (rotated) when its ETag changes.
+package httpfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpcloud/tail/vfs"
+)
+
+// FS is a vfs.FS whose file names are http or https URLs.
+type FS struct {
+	// Client is used to make requests; http.DefaultClient when nil.
+	Client *http.Client
+
+	// Header is added to every request, eg: for authorization.
+	Header http.Header
+
+	// RotationByETag makes a change of ETag signal that the file was
+	// replaced. Only set it for servers deriving ETags from the file
+	// identity rather than from its size or modification time, since
+	// every append would otherwise look like a rotation.
+	RotationByETag bool
+}
+
+// New returns an FS making requests with client, or with
+// http.DefaultClient when nil.
+func New(client *http.Client) *FS {
+	return &FS{Client: client}
+}
+
+// ErrUnknownSize is the error of Stat for servers telling neither the
+// range of the requested bytes nor the length of the file.
+var ErrUnknownSize = errors.New("httpfs: unknown file size")
+
+// temporaryError is an error of the network or the server, such as a
+// 503 response, after which requests may succeed again. Watchers keep
+// polling files whose Stat fails with one.
+type temporaryError struct {
+	error
+}
+
+func (e temporaryError) Temporary() bool { return true }
+
+// temporaryStatus reports whether requests failing with status may
+// succeed again.
+func temporaryStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// fileInfo is the os.FileInfo of a URL.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return 0444 }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return false }
+func (fi *fileInfo) Sys() interface{}   { return fi.etag }
+
+func (fs *FS) client() *http.Client {
+	if fs.Client != nil {
+		return fs.Client
+	}
+	return http.DefaultClient
+}
+
+// get requests the given byte range of url.
+func (fs *FS) get(url string, byteRange string) (*http.Response, error) {
+	return fs.do("GET", url, byteRange)
+}
+
+// do makes a request of url, for the given byte range unless empty.
+func (fs *FS) do(method, url string, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fs.Header {
+		req.Header[k] = v
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", "bytes="+byteRange)
+	}
+	resp, err := fs.client().Do(req)
+	if err != nil {
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: url, Err: temporaryError{err}}
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		resp.Body.Close()
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: url, Err: os.ErrNotExist}
+	}
+	return resp, nil
+}
+
+// Stat fetches the first byte of url to learn its size and identity.
+func (fs *FS) Stat(url string) (os.FileInfo, error) {
+	resp, err := fs.get(url, "0-0")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	fi := &fileInfo{
+		name: path.Base(url),
+		etag: resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		fi.modTime = t
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		// "bytes 0-0/size" or "bytes */size" (empty file)
+		_, _, fi.size, err = parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, &os.PathError{Op: "stat", Path: url, Err: err}
+		}
+	case http.StatusOK:
+		// The range was ignored: this is the whole file.
+		fi.size = resp.ContentLength
+		if fi.size < 0 {
+			// Sent in chunks, of unknown length until read.
+			if fi.size, err = fs.headSize(url); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+		if temporaryStatus(resp.StatusCode) {
+			err = temporaryError{err}
+		}
+		return nil, &os.PathError{Op: "stat", Path: url, Err: err}
+	}
+	return fi, nil
+}
+
+// SameFile reports false if the ETags of fi1 and fi2 differ, with
+// RotationByETag. Otherwise files are assumed to be the same, leaving
+// truncations to be detected by size.
+func (fs *FS) SameFile(fi1, fi2 os.FileInfo) bool {
+	if !fs.RotationByETag {
+		return true
+	}
+	hfi1, ok1 := fi1.(*fileInfo)
+	hfi2, ok2 := fi2.(*fileInfo)
+	return ok1 && ok2 && hfi1.etag == hfi2.etag
+}
+
+// headSize returns the length of url from a HEAD request.
+func (fs *FS) headSize(url string) (int64, error) {
+	resp, err := fs.do("HEAD", url, "")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK && resp.ContentLength >= 0:
+		return resp.ContentLength, nil
+	case temporaryStatus(resp.StatusCode):
+		err = temporaryError{fmt.Errorf("unexpected status %s", resp.Status)}
+	default:
+		err = ErrUnknownSize
+	}
+	return 0, &os.PathError{Op: "stat", Path: url, Err: err}
+}
+
+// Open checks that url exists, and returns a file reading it with range
+// requests.
+func (fs *FS) Open(url string) (vfs.File, error) {
+	fi, err := fs.Stat(url)
+	if err != nil {
+		return nil, err
+	}
+	return &file{fs: fs, url: url, etag: fi.(*fileInfo).etag}, nil
+}
+
+// file reads a URL from its offset onwards. Reads are served from the
+// body of one request until it is exhausted; the next read after that
+// makes a new request.
+type file struct {
+	fs     *FS
+	url    string
+	etag   string
+	offset int64
+	body   io.ReadCloser
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.body == nil {
+		if err := f.request(); err != nil {
+			return 0, err
+		}
+		if f.body == nil {
+			return 0, io.EOF
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF {
+		f.closeBody()
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// request starts fetching the file from f.offset. It leaves f.body nil
+// when there is nothing to read.
+func (f *file) request() error {
+	resp, err := f.fs.get(f.url, fmt.Sprintf("%d-", f.offset))
+	if os.IsNotExist(err) {
+		// Deletion is left to the watcher to report.
+		return nil
+	}
+	if perr, ok := err.(*os.PathError); ok {
+		if _, ok := perr.Err.(temporaryError); ok {
+			// Read again on the next change.
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.fs.RotationByETag && f.etag != "" {
+		if etag := resp.Header.Get("ETag"); etag != "" && etag != f.etag {
+			// Replaced; the watcher will report it.
+			resp.Body.Close()
+			return nil
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != f.offset {
+			resp.Body.Close()
+			return fmt.Errorf("%s: unexpected Content-Range %q", f.url, resp.Header.Get("Content-Range"))
+		}
+		f.body = resp.Body
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing past offset, or truncated; the watcher will tell.
+		resp.Body.Close()
+	case http.StatusOK:
+		// The server ignored the range.
+		skipped, err := io.CopyN(ioutil.Discard, resp.Body, f.offset)
+		if err != nil || skipped < f.offset {
+			resp.Body.Close()
+			return nil
+		}
+		f.body = resp.Body
+	default:
+		if temporaryStatus(resp.StatusCode) {
+			// Read again on the next change.
+			resp.Body.Close()
+			return nil
+		}
+		resp.Body.Close()
+		return fmt.Errorf("%s: unexpected status %s", f.url, resp.Status)
+	}
+	return nil
+}
+
+func (f *file) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_CUR:
+		offset += f.offset
+	case os.SEEK_END:
+		fi, err := f.fs.Stat(f.url)
+		if err != nil {
+			return f.offset, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return f.offset, &os.PathError{Op: "seek", Path: f.url, Err: os.ErrInvalid}
+	}
+	if offset != f.offset {
+		f.closeBody()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	f.closeBody()
+	return nil
+}
+
+// parseContentRange parses "bytes first-last/size" and "bytes */size".
+// first and last are -1 in the latter form.
+func parseContentRange(s string) (first, last, size int64, err error) {
+	first, last = -1, -1
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	s = strings.TrimPrefix(s, "bytes ")
+	slash := strings.IndexByte(s, '/')
+	if slash < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	if size, err = strconv.ParseInt(s[slash+1:], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range size %q", s)
+	}
+	if rng := s[:slash]; rng != "*" {
+		dash := strings.IndexByte(rng, '-')
+		if dash < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+		}
+		if first, err = strconv.ParseInt(rng[:dash], 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+		if last, err = strconv.ParseInt(rng[dash+1:], 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return first, last, size, nil
+}
@@ -0,0 +1,222 @@
+package httpfs_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/hpcloud/tail/httpfs"
+)
+
+// logServer serves a log file which can be appended, truncated and
+// rotated. Its ETag changes on rotation only.
+type logServer struct {
+	mux        sync.Mutex
+	data       []byte
+	generation int
+	status     int // Of every response, when set
+}
+
+func (s *logServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	data := append([]byte(nil), s.data...)
+	generation, status := s.generation, s.status
+	s.mux.Unlock()
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, generation))
+	http.ServeContent(w, r, "app.log", time.Time{}, bytes.NewReader(data))
+}
+
+func (s *logServer) set(data string, rotate bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data = []byte(data)
+	if rotate {
+		s.generation++
+	}
+}
+
+func (s *logServer) setStatus(status int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.status = status
+}
+
+func (s *logServer) append(data string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data = append(s.data, data...)
+}
+
+func TestTailHTTP(t *testing.T) {
+	logs := &logServer{data: []byte("hello\nworld\n")}
+	server := httptest.NewServer(logs)
+	defer server.Close()
+
+	tl, err := tail.TailFile(server.URL+"/app.log", tail.Config{
+		Follow:       true,
+		ReOpen:       true,
+		FS:           &httpfs.FS{RotationByETag: true},
+		PollInterval: 5 * time.Millisecond,
+		Logger:       tail.DiscardingLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Stop()
+
+	expect := func(lines ...string) {
+		for _, want := range lines {
+			select {
+			case line := <-tl.Lines:
+				if line.Text != want {
+					t.Fatalf("expected %q, got %q", want, line.Text)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	expect("hello", "world")
+
+	logs.append("more\nda")
+	expect("more")
+	logs.append("ta\n")
+	expect("data")
+
+	// Truncated
+	logs.set("short\n", false)
+	expect("short")
+
+	// Rotated to a larger file
+	logs.set("rotated file\n", true)
+	expect("rotated file")
+}
+
+func TestStat(t *testing.T) {
+	logs := &logServer{data: []byte("hello\n")}
+	server := httptest.NewServer(logs)
+	defer server.Close()
+
+	fs := httpfs.New(nil)
+	fi, err := fs.Stat(server.URL + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 6 {
+		t.Errorf("expected size 6, got %d", fi.Size())
+	}
+
+	logs.set("", false)
+	if fi, err = fs.Stat(server.URL + "/app.log"); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() != 0 {
+		t.Errorf("expected size 0, got %d", fi.Size())
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	if _, err := fs.Stat(notFound.URL + "/app.log"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// chunkedServer ignores ranges, and sends files in chunks of unknown
+// length; it answers HEAD requests with the length if headLength.
+type chunkedServer struct {
+	data       string
+	headLength bool
+}
+
+func (s *chunkedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "HEAD" {
+		if s.headLength {
+			w.Header().Set("Content-Length", fmt.Sprint(len(s.data)))
+		}
+		return
+	}
+	io.WriteString(w, s.data)
+	w.(http.Flusher).Flush()
+}
+
+func TestStatChunked(t *testing.T) {
+	server := httptest.NewServer(&chunkedServer{data: "hello\n", headLength: true})
+	defer server.Close()
+
+	fs := httpfs.New(nil)
+	fi, err := fs.Stat(server.URL + "/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 6 {
+		t.Errorf("expected size 6 from HEAD, got %d", fi.Size())
+	}
+
+	unknown := httptest.NewServer(&chunkedServer{data: "hello\n"})
+	defer unknown.Close()
+	if _, err := fs.Stat(unknown.URL + "/app.log"); err == nil || err.(*os.PathError).Err != httpfs.ErrUnknownSize {
+		t.Errorf("expected ErrUnknownSize, got %v", err)
+	}
+}
+
+func TestTailHTTPUnavailable(t *testing.T) {
+	logs := &logServer{data: []byte("hello\n")}
+	server := httptest.NewServer(logs)
+	defer server.Close()
+
+	tl, err := tail.TailFile(server.URL+"/app.log", tail.Config{
+		Follow:       true,
+		FS:           httpfs.New(nil),
+		PollInterval: 5 * time.Millisecond,
+		Logger:       tail.DiscardingLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Stop()
+	next := func() *tail.Line {
+		select {
+		case line, ok := <-tl.Lines:
+			if !ok {
+				t.Fatalf("tail stopped: %v", tl.Wait())
+			}
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a line")
+			return nil
+		}
+	}
+	if line := next(); line.Text != "hello" {
+		t.Fatalf("expected hello, got %q", line.Text)
+	}
+
+	// Polls failing with 503 are retried.
+	logs.setStatus(http.StatusServiceUnavailable)
+	time.Sleep(50 * time.Millisecond)
+	logs.setStatus(0)
+	logs.append("back\n")
+	if line := next(); line.Text != "back" {
+		t.Fatalf("expected back, got %q", line.Text)
+	}
+
+	// Other errors stop the tail.
+	logs.setStatus(http.StatusForbidden)
+	if line, ok := <-tl.Lines; ok {
+		t.Fatalf("expected the tail to stop, got %q", line.Text)
+	}
+	if err := tl.Wait(); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the 403 error, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// Package hub broadcasts the lines of one tail to many subscribers, so
+// that components wanting the same file share its reading, and its
+// rotations.
+//
+//	t, err := tail.TailFile("/var/log/app.log", tail.Config{Follow: true, ReOpen: true})
+//	...
+//	h := hub.New(t, 100)
+//	s := h.Subscribe(hub.Options{Slow: hub.DropOldest, Replay: 10})
+//	for line := range s.Lines {
+//		...
+//	}
+//
+// Each subscriber has its own buffer, and its own policy for when it
+// is full. Subscribers may ask for the last lines sent before they
+// subscribed, up to the history kept by the Hub.
+package hub
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hpcloud/tail"
+)
+
+// ErrSlow is the error of subscriptions closed by Disconnect.
+var ErrSlow = errors.New("hub: subscriber too slow")
+
+// SlowPolicy is what sending a line to a subscriber whose buffer is
+// full does.
+type SlowPolicy int
+
+const (
+	Block      SlowPolicy = iota // Wait for it, holding back the other subscribers
+	DropNewest                   // Drop the line
+	DropOldest                   // Drop the oldest buffered line to make room
+	Disconnect                   // Close the subscription, with ErrSlow
+)
+
+// DEFAULT_BUFFER is the default Options.Buffer.
+var DEFAULT_BUFFER = 100
+
+// Options configures a subscription.
+type Options struct {
+	// Buffer is the number of lines buffered for the subscriber;
+	// DEFAULT_BUFFER when zero.
+	Buffer int
+	Slow   SlowPolicy
+
+	// Replay is the number of the last lines to send first, if kept in
+	// the history of the Hub.
+	Replay int
+}
+
+// Hub sends the lines of a tail to its subscribers. It is safe for
+// concurrent use.
+type Hub struct {
+	t *tail.Tail
+
+	mux     sync.Mutex
+	history []*tail.Line // Up to size, oldest first
+	size    int
+	subs    map[*Subscription]bool
+	ended   bool
+	err     error
+	done    chan struct{}
+}
+
+// New starts receiving the lines of t, keeping the last history ones
+// for subscribers to replay. Lines carrying an error are sent, but not
+// kept.
+func New(t *tail.Tail, history int) *Hub {
+	h := &Hub{
+		t:    t,
+		size: history,
+		subs: make(map[*Subscription]bool),
+		done: make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *Hub) run() {
+	defer close(h.done)
+	for line := range h.t.Lines {
+		h.mux.Lock()
+		if line.Err == nil && h.size > 0 {
+			if len(h.history) == h.size {
+				copy(h.history, h.history[1:])
+				h.history = h.history[:h.size-1]
+			}
+			h.history = append(h.history, line)
+		}
+		subs := h.subscribers()
+		h.mux.Unlock()
+		for _, s := range subs {
+			if !s.send(line) {
+				h.remove(s)
+			}
+		}
+	}
+
+	err := h.t.Wait()
+	h.mux.Lock()
+	h.ended = true
+	h.err = err
+	subs := h.subscribers()
+	h.subs = nil
+	h.mux.Unlock()
+	for _, s := range subs {
+		s.close(err)
+	}
+}
+
+// subscribers returns the subscribers, with mux held.
+func (h *Hub) subscribers() []*Subscription {
+	subs := make([]*Subscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mux.Lock()
+	delete(h.subs, s)
+	h.mux.Unlock()
+}
+
+// Subscribe returns a new subscription to the lines of the tail, which
+// starts with the lines replayed. Once the tail stopped, its Lines are
+// closed after them.
+func (h *Hub) Subscribe(opts Options) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DEFAULT_BUFFER
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	replay := h.history
+	if opts.Replay <= 0 {
+		replay = nil
+	} else if opts.Replay < len(replay) {
+		replay = replay[len(replay)-opts.Replay:]
+	}
+	lines := make(chan *tail.Line, opts.Buffer+len(replay))
+	for _, line := range replay {
+		lines <- line
+	}
+	s := &Subscription{
+		Lines: lines,
+		hub:   h,
+		slow:  opts.Slow,
+		lines: lines,
+		done:  make(chan struct{}),
+	}
+	if h.ended {
+		s.close(h.err)
+	} else {
+		h.subs[s] = true
+	}
+	return s
+}
+
+// Stop closes the subscriptions, stops the tail and returns its error.
+func (h *Hub) Stop() error {
+	h.mux.Lock()
+	subs := h.subscribers()
+	h.subs = make(map[*Subscription]bool)
+	h.mux.Unlock()
+	for _, s := range subs {
+		s.close(nil)
+	}
+	err := h.t.Stop()
+	<-h.done
+	return err
+}
+
+// Wait waits for the tail to stop, and returns its error.
+func (h *Hub) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Subscription is a subscriber of a Hub.
+type Subscription struct {
+	// Lines receives the lines of the tail, and is closed once the
+	// subscription is.
+	Lines <-chan *tail.Line
+
+	hub  *Hub
+	slow SlowPolicy
+
+	mux     sync.Mutex
+	lines   chan *tail.Line
+	done    chan struct{} // Closed along with the subscription
+	closed  bool
+	sending bool // Blocked sending, to close lines after
+	dropped int64
+	err     error
+}
+
+// send sends line, following the slow policy. It returns false if the
+// subscription is closed.
+func (s *Subscription) send(line *tail.Line) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.lines <- line:
+		return true
+	default:
+	}
+
+	switch s.slow {
+	case DropNewest:
+		s.dropped++
+	case DropOldest:
+		// Only the hub sends, so there is room once a line is taken,
+		// by the subscriber or here.
+		select {
+		case <-s.lines:
+			s.dropped++
+		default:
+		}
+		s.lines <- line
+	case Disconnect:
+		s.closeLocked(ErrSlow)
+		return false
+	default: // Block
+		s.sending = true
+		s.mux.Unlock()
+		select {
+		case s.lines <- line:
+		case <-s.done:
+		}
+		s.mux.Lock()
+		s.sending = false
+		if s.closed {
+			close(s.lines)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subscription) close(err error) {
+	s.mux.Lock()
+	s.closeLocked(err)
+	s.mux.Unlock()
+}
+
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.done)
+	if !s.sending {
+		close(s.lines)
+	}
+}
+
+// Close unsubscribes, and closes Lines, from which the lines already
+// buffered are still received.
+func (s *Subscription) Close() error {
+	s.hub.remove(s)
+	s.close(nil)
+	return nil
+}
+
+// Dropped returns the number of lines dropped by DropNewest or
+// DropOldest.
+func (s *Subscription) Dropped() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.dropped
+}
+
+// Err returns ErrSlow if the subscription was closed by Disconnect, or
+// the error of the tail once it stopped, and nil otherwise.
+func (s *Subscription) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.err
+}
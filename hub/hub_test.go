@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// newTestHub returns a hub tailing what is written to the returned
+// pipe.
+func newTestHub(t *testing.T, history int) (*Hub, *io.PipeWriter) {
+	r, w := io.Pipe()
+	tl, err := tail.TailReader(r, tail.Config{Logger: tail.DiscardingLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(tl, history), w
+}
+
+func receive(t *testing.T, s *Subscription, n int) []string {
+	var texts []string
+	for i := 0; i < n; i++ {
+		select {
+		case line, ok := <-s.Lines:
+			if !ok {
+				t.Fatalf("subscription closed after %q", texts)
+			}
+			texts = append(texts, line.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %q", texts)
+		}
+	}
+	return texts
+}
+
+func expectLines(t *testing.T, got []string, expected ...string) {
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected lines %q, got %q", expected, got)
+	}
+}
+
+func TestHub(t *testing.T) {
+	h, w := newTestHub(t, 2)
+	first := h.Subscribe(Options{})
+	second := h.Subscribe(Options{Replay: 5})
+	io.WriteString(w, "a\nb\nc\n")
+	expectLines(t, receive(t, first, 3), "a", "b", "c")
+	expectLines(t, receive(t, second, 3), "a", "b", "c")
+
+	// Late subscribers replay up to the history kept.
+	late := h.Subscribe(Options{Replay: 5})
+	io.WriteString(w, "d\n")
+	expectLines(t, receive(t, late, 3), "b", "c", "d")
+	expectLines(t, receive(t, first, 1), "d")
+
+	// Closed subscriptions no longer receive lines.
+	second.Close()
+	io.WriteString(w, "e\n")
+	w.Close()
+	expectLines(t, receive(t, first, 1), "e")
+	expectLines(t, receive(t, second, 1), "d")
+	for _, s := range []*Subscription{first, second} {
+		if line, ok := <-s.Lines; ok {
+			t.Errorf("expected closed lines, got %q", line.Text)
+		}
+	}
+	if err := h.Wait(); err != nil {
+		t.Error(err)
+	}
+	if s := h.Subscribe(Options{Replay: -1}); len(s.Lines) != 0 {
+		t.Errorf("expected a negative replay to replay nothing, got %d lines", len(s.Lines))
+	}
+	if s := h.Subscribe(Options{Replay: 1}); strings.Join(receive(t, s, 1), "") != "e" {
+		t.Error("expected the history to be replayed after the tail stopped")
+	} else if _, ok := <-s.Lines; ok {
+		t.Error("expected subscribing after the tail stopped to close lines")
+	}
+}
+
+func TestSlowPolicies(t *testing.T) {
+	h, w := newTestHub(t, 0)
+	defer w.Close()
+	line := func(text string) *tail.Line { return &tail.Line{Text: text} }
+	for _, test := range []struct {
+		slow     SlowPolicy
+		expected []string
+		dropped  int64
+		err      error
+	}{
+		{DropNewest, []string{"a", "b"}, 1, nil},
+		{DropOldest, []string{"b", "c"}, 1, nil},
+		{Disconnect, []string{"a", "b"}, 0, ErrSlow},
+	} {
+		s := h.Subscribe(Options{Buffer: 2, Slow: test.slow})
+		h.remove(s) // Sent to directly
+		for _, text := range []string{"a", "b", "c"} {
+			s.send(line(text))
+		}
+		if test.err == nil {
+			s.Close()
+		}
+		var texts []string
+		for l := range s.Lines {
+			texts = append(texts, l.Text)
+		}
+		expectLines(t, texts, test.expected...)
+		if s.Dropped() != test.dropped || s.Err() != test.err {
+			t.Errorf("policy %d: expected %d dropped and error %v, got %d and %v",
+				test.slow, test.dropped, test.err, s.Dropped(), s.Err())
+		}
+	}
+
+	// Blocked subscribers are unblocked by Close.
+	s := h.Subscribe(Options{Buffer: 1})
+	h.remove(s)
+	s.send(line("a"))
+	done := make(chan bool)
+	go func() {
+		done <- s.send(line("b"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	if <-done {
+		t.Error("expected the blocked line to be dropped by Close")
+	}
+	expectLines(t, receive(t, s, 1), "a")
+}
+
+func TestStop(t *testing.T) {
+	h, w := newTestHub(t, 0)
+	defer w.Close()
+	s := h.Subscribe(Options{Buffer: 1})
+	io.WriteString(w, "a\nb\nc\n")
+
+	// The subscriber does not receive, blocking the hub.
+	time.Sleep(50 * time.Millisecond)
+	if err := h.Stop(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-s.Lines; !ok {
+		t.Error("expected the buffered line")
+	}
+	if _, ok := <-s.Lines; ok {
+		t.Error("expected lines to be closed")
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// +build go1.7
+
+package tail
+
+import (
+	"context"
+	"io"
+)
+
+// Next returns the next line, waiting for it until ctx is done, in
+// which case it returns ctx.Err(). Once tailing ended, it returns
+// io.EOF if it ended at the end of a file not followed, or with Stop or
+// StopAtEOF, and otherwise the error that stopped it; from then on, it
+// keeps returning that error. Lines such as rate limit warnings carry
+// their own error in Line.Err, which does not end tailing.
+//
+// Next receives from Lines: use one or the other.
+func (tail *Tail) Next(ctx context.Context) (*Line, error) {
+	select {
+	case line, ok := <-tail.Lines:
+		if ok {
+			return line, nil
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := tail.Wait(); err != nil && err != errStopAtEOF {
+		return nil, err
+	}
+	return nil, io.EOF
+}
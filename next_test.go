@@ -0,0 +1,47 @@
+// +build go1.7
+
+package tail
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	tailTest := NewTailTest("next", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{})
+	ctx := context.Background()
+	for _, expected := range []string{"hello", "world"} {
+		line, err := tail.Next(ctx)
+		if err != nil || line.Text != expected {
+			t.Fatalf("expected %q, got %+v and %v", expected, line, err)
+		}
+	}
+	// The end is returned again after the first time.
+	for i := 0; i < 2; i++ {
+		if line, err := tail.Next(ctx); line != nil || err != io.EOF {
+			t.Errorf("expected io.EOF, got %+v and %v", line, err)
+		}
+	}
+	tail.Cleanup()
+}
+
+func TestNextContext(t *testing.T) {
+	tailTest := NewTailTest("next-context", t)
+	tailTest.CreateFile("test.txt", "")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tail.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	go tail.Stop()
+	if _, err := tail.Next(context.Background()); err != io.EOF {
+		t.Errorf("expected io.EOF after Stop, got %v", err)
+	}
+	tail.Cleanup()
+}
@@ -0,0 +1,64 @@
+// +build linux darwin freebsd netbsd openbsd
+
+package tail
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPipeWriterReconnects(t *testing.T) {
+	tailTest := NewTailTest("pipe-reconnect", t)
+	fifo := tailTest.path + "/test.fifo"
+	os.Remove(fifo)
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tail := tailTest.StartTail("test.fifo", Config{Follow: true, Pipe: true, MustExist: true})
+
+	go func() {
+		for _, data := range []string{"hello\nworld\n", "more\ndata", "endofworld\n"} {
+			w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			w.WriteString(data)
+			w.Close()
+			<-time.After(50 * time.Millisecond)
+		}
+	}()
+	tailTest.ReadLines(tail, []string{"hello", "world", "more", "data", "endofworld"})
+
+	// Stop must not hang while waiting for the next writer.
+	if err := tail.Stop(); err != nil {
+		t.Error(err)
+	}
+	os.Remove(fifo)
+}
+
+func TestPipeStopWhileReading(t *testing.T) {
+	tailTest := NewTailTest("pipe-stop", t)
+	fifo := tailTest.path + "/test.fifo"
+	os.Remove(fifo)
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tail := tailTest.StartTail("test.fifo", Config{Follow: true, Pipe: true})
+
+	w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WriteString("hello\n")
+	tailTest.ReadLines(tail, []string{"hello"})
+
+	// The writer is still connected, so tail is blocked reading.
+	if err := tail.Stop(); err != nil {
+		t.Error(err)
+	}
+	os.Remove(fifo)
+}
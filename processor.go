@@ -0,0 +1,147 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// ProcessFunc processes a line, returning the lines replacing it: the
+// line itself, changed or not, none to drop it, or several to split
+// it. On error, it must leave the line unchanged.
+type ProcessFunc func(line *Line) ([]*Line, error)
+
+// ErrorPolicy is what a Processor failing to process a line does.
+type ErrorPolicy int
+
+const (
+	PassOnError ErrorPolicy = iota // Pass the line on unchanged
+	DropOnError                    // Drop the line
+	StopOnError                    // Stop the tail with the error
+)
+
+// Processor is a stage of Config.Processors, which lines go through in
+// turn before being sent to Lines.
+type Processor struct {
+	Name    string // In errors
+	Process ProcessFunc
+	OnError ErrorPolicy
+
+	mux   sync.Mutex
+	stats ProcessorStats
+}
+
+// ProcessorStats counts the lines gone through a Processor.
+type ProcessorStats struct {
+	In      uint64 // Lines processed
+	Out     uint64 // Lines returned, or passed on after an error
+	Dropped uint64 // Lines replaced by none, or dropped after an error
+	Errors  uint64
+}
+
+// Stats returns the counters of p.
+func (p *Processor) Stats() ProcessorStats {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.stats
+}
+
+// process runs line through p, returning the lines it is replaced by.
+func (p *Processor) process(line *Line) ([]*Line, error) {
+	lines, err := p.Process(line)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.stats.In++
+	if err != nil {
+		p.stats.Errors++
+		switch p.OnError {
+		case PassOnError:
+			lines = []*Line{line}
+		case DropOnError:
+			lines = nil
+		default:
+			return nil, fmt.Errorf("processor %s: %s", p.Name, err)
+		}
+	}
+	if len(lines) == 0 {
+		p.stats.Dropped++
+	}
+	p.stats.Out += uint64(len(lines))
+	return lines, nil
+}
+
+// process runs line through the processors of the tail.
+func (tail *Tail) process(line *Line) ([]*Line, error) {
+	lines := []*Line{line}
+	for _, p := range tail.Processors {
+		var out []*Line
+		for _, line := range lines {
+			processed, err := p.process(line)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, processed...)
+		}
+		if lines = out; len(lines) == 0 {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// Replace returns a Processor replacing the matches of re in lines
+// with repl, as regexp.ReplaceAllString does.
+func Replace(re *regexp.Regexp, repl string) *Processor {
+	return &Processor{
+		Name: "replace " + re.String(),
+		Process: func(line *Line) ([]*Line, error) {
+			line.Text = re.ReplaceAllString(line.Text, repl)
+			return []*Line{line}, nil
+		},
+	}
+}
+
+// Drop returns a Processor dropping the lines matching re.
+func Drop(re *regexp.Regexp) *Processor {
+	return &Processor{
+		Name: "drop " + re.String(),
+		Process: func(line *Line) ([]*Line, error) {
+			if re.MatchString(line.Text) {
+				return nil, nil
+			}
+			return []*Line{line}, nil
+		},
+	}
+}
+
+// AddFields returns a Processor setting fields of lines, eg: the host
+// or service they come from.
+func AddFields(fields map[string]string) *Processor {
+	return &Processor{
+		Name: "add fields",
+		Process: func(line *Line) ([]*Line, error) {
+			if line.Fields == nil {
+				line.Fields = make(map[string]string, len(fields))
+			}
+			for k, v := range fields {
+				line.Fields[k] = v
+			}
+			return []*Line{line}, nil
+		},
+	}
+}
+
+// DropFields returns a Processor removing fields from lines.
+func DropFields(names ...string) *Processor {
+	return &Processor{
+		Name: "drop fields",
+		Process: func(line *Line) ([]*Line, error) {
+			for _, name := range names {
+				delete(line.Fields, name)
+			}
+			return []*Line{line}, nil
+		},
+	}
+}
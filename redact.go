@@ -0,0 +1,128 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+)
+
+// RedactRule masks secrets or personal data matching a pattern, for
+// Redact.
+type RedactRule struct {
+	Name string
+
+	// Regexp matches what is masked: its first capture group, eg: the
+	// value of a password=value pair, or the whole match without
+	// groups.
+	Regexp *regexp.Regexp
+
+	// Valid, when set, tells which matches are masked, eg: numbers with
+	// a valid checksum.
+	Valid func(match string) bool
+
+	// Mask replaces the matches; "[REDACTED:Name]" when empty.
+	Mask string
+
+	mux   sync.Mutex
+	count uint64
+}
+
+// Count returns the number of matches masked by r.
+func (r *RedactRule) Count() uint64 {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.count
+}
+
+// redact returns s with the matches of r masked.
+func (r *RedactRule) redact(s string) string {
+	matches := r.Regexp.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	mask := r.Mask
+	if mask == "" {
+		mask = "[REDACTED:" + r.Name + "]"
+	}
+	var b bytes.Buffer
+	last, n := 0, uint64(0)
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 {
+			if start, end = m[2], m[3]; start < 0 {
+				continue // The group did not match
+			}
+		}
+		if r.Valid != nil && !r.Valid(s[start:end]) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(mask)
+		last = end
+		n++
+	}
+	if n == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	r.mux.Lock()
+	r.count += n
+	r.mux.Unlock()
+	return b.String()
+}
+
+// Redact returns a Processor masking the matches of rules in the text
+// and field values of lines, such as those of RedactCatalog, in turn.
+func Redact(rules ...*RedactRule) *Processor {
+	return &Processor{
+		Name: "redact",
+		Process: func(line *Line) ([]*Line, error) {
+			for _, r := range rules {
+				line.Text = r.redact(line.Text)
+				for k, v := range line.Fields {
+					line.Fields[k] = r.redact(v)
+				}
+			}
+			return []*Line{line}, nil
+		},
+	}
+}
+
+// RedactCatalog returns new rules masking common secrets and personal
+// data: JSON web tokens, AWS keys, bearer tokens, passwords in
+// key=value pairs, card numbers passing the Luhn check, and email
+// addresses.
+func RedactCatalog() []*RedactRule {
+	return []*RedactRule{
+		{Name: "jwt", Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+		{Name: "aws-access-key", Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+		{Name: "aws-secret-key", Regexp: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+		{Name: "bearer", Regexp: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`)},
+		{Name: "password", Regexp: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)["']?\s*[=:]\s*("[^"]*"|'[^']*'|[^\s,;&]+)`)},
+		{Name: "card", Regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Valid: luhn},
+		{Name: "email", Regexp: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	}
+}
+
+// luhn reports whether the digits of s, ignoring spaces and dashes,
+// pass the Luhn check of card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// Package sink ships the lines of a tail to destinations, such as a
+// syslog relay.
+//
+//	t, err := tail.TailFile("/var/log/app.log", tail.Config{Follow: true, ReOpen: true})
+//	...
+//	err = sink.Run(t, &sink.Syslog{Network: "tcp", Addr: "relay:514", AppName: "app"})
+package sink
+
+import (
+	"errors"
+
+	"github.com/hpcloud/tail"
+)
+
+// ErrClosed is returned when writing to a closed sink.
+var ErrClosed = errors.New("sink: closed")
+
+// Sink is a destination for lines.
+type Sink interface {
+	// Write ships a line. It may block until the line is delivered,
+	// eg: while reconnecting.
+	Write(line *tail.Line) error
+
+	// Close releases the resources of the sink, and unblocks pending
+	// writes, which then return ErrClosed.
+	Close() error
+}
+
+// Run writes the lines of t to s until t stops, and then closes s.
+// Lines carrying an error are skipped, and the others acknowledged
+// once written, for t.Checkpoint with tail.Config.Ack. When s fails to
+// write a line, t is stopped and the error returned.
+func Run(t *tail.Tail, s Sink) error {
+	defer s.Close()
+	for line := range t.Lines {
+		if line.Err != nil {
+			continue
+		}
+		if err := s.Write(line); err != nil {
+			t.Kill(err)
+			for _ = range t.Lines {
+			}
+			break
+		}
+		line.Ack()
+	}
+	return t.Wait()
+}
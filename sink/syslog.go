@@ -0,0 +1,292 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package sink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// Format is the format of syslog messages.
+type Format int
+
+const (
+	RFC5424 Format = iota // The syslog protocol
+	RFC3164               // BSD syslog
+)
+
+// Facility is the syslog facility of messages.
+type Facility int
+
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslogd
+	LPR
+	News
+	UUCP
+	Cron
+	AuthPriv
+	FTP
+)
+
+const (
+	Local0 Facility = iota + 16
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+// Severity is the syslog severity of messages.
+type Severity int
+
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// SYSLOG_MIN_BACKOFF is the initial delay between attempts to deliver
+// a message, doubled on every failure up to Syslog.MaxBackoff.
+var SYSLOG_MIN_BACKOFF = 100 * time.Millisecond
+
+// Syslog is a Sink sending lines to a syslog server, over UDP, or over
+// TCP or TLS with octet-counting framing (RFC 6587). Messages that
+// cannot be delivered are retried, reconnecting as needed, until Close.
+type Syslog struct {
+	Network   string      // "udp", "tcp" or "tls"
+	Addr      string      // Address of the server, eg: "relay:514"
+	TLSConfig *tls.Config // With "tls"
+
+	Format   Format
+	Facility Facility
+	Severity Severity
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string // RFC5424 only
+
+	// Timeout of connecting and writing a message; 10s when zero.
+	Timeout time.Duration
+	// Maximum delay between attempts to deliver a message; 30s when
+	// zero.
+	MaxBackoff time.Duration
+
+	mux    sync.Mutex
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+// NewSyslog returns a Syslog sending RFC 5424 messages of facility
+// User and severity Info to addr, identified by the host name, program
+// name and process ID.
+func NewSyslog(network, addr string) *Syslog {
+	hostname, _ := os.Hostname()
+	return &Syslog{
+		Network:  network,
+		Addr:     addr,
+		Format:   RFC5424,
+		Facility: User,
+		Severity: Info,
+		Hostname: hostname,
+		AppName:  filepath.Base(os.Args[0]),
+		ProcID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+func (s *Syslog) init() {
+	s.once.Do(func() {
+		s.closed = make(chan struct{})
+	})
+}
+
+// Write sends a line, blocking until it is delivered or s is closed.
+func (s *Syslog) Write(line *tail.Line) error {
+	s.init()
+	msg := s.format(line)
+	backoff := SYSLOG_MIN_BACKOFF
+	maxBackoff := s.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	for {
+		err := s.send(msg)
+		if err == nil || err == ErrClosed {
+			return err
+		}
+		select {
+		case <-s.closed:
+			return ErrClosed
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send writes a message once, connecting first if needed.
+func (s *Syslog) send(msg string) error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	if s.Network != "udp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	conn.SetWriteDeadline(time.Now().Add(s.timeout()))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		s.mux.Lock()
+		if s.conn == conn {
+			s.conn = nil
+		}
+		s.mux.Unlock()
+		conn.Close()
+		select {
+		case <-s.closed:
+			return ErrClosed
+		default:
+		}
+		return err
+	}
+	return nil
+}
+
+// connect returns the connection, dialing it if needed. Dialing is
+// done without holding mux, so that Close does not wait for it.
+func (s *Syslog) connect() (net.Conn, error) {
+	s.mux.Lock()
+	conn := s.conn
+	s.mux.Unlock()
+	select {
+	case <-s.closed:
+		return nil, ErrClosed
+	default:
+	}
+	if conn != nil {
+		return conn, nil
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	select {
+	case <-s.closed:
+		conn.Close()
+		return nil, ErrClosed
+	default:
+	}
+	if s.conn != nil {
+		// Dialed concurrently by another Write.
+		conn.Close()
+		return s.conn, nil
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *Syslog) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout()}
+	switch s.Network {
+	case "udp", "tcp":
+		return dialer.Dial(s.Network, s.Addr)
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", s.Addr, s.TLSConfig)
+	}
+	return nil, fmt.Errorf("sink: unknown syslog network %q", s.Network)
+}
+
+func (s *Syslog) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 10 * time.Second
+}
+
+// Close closes the connection, and makes pending writes return
+// ErrClosed.
+func (s *Syslog) Close() error {
+	s.init()
+	s.mux.Lock()
+	select {
+	case <-s.closed:
+		s.mux.Unlock()
+		return nil
+	default:
+		close(s.closed)
+	}
+	conn := s.conn
+	s.conn = nil
+	s.mux.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// format returns the syslog message of a line.
+func (s *Syslog) format(line *tail.Line) string {
+	t := line.EventTime
+	if t.IsZero() {
+		t = line.Time
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	pri := int(s.Facility)*8 + int(s.Severity)
+	if s.Format == RFC3164 {
+		tag := headerField(s.AppName, 32)
+		if s.ProcID != "" {
+			tag += "[" + headerField(s.ProcID, 128) + "]"
+		}
+		return fmt.Sprintf("<%d>%s %s %s: %s", pri, t.Format(time.Stamp),
+			headerField(s.Hostname, 255), tag, line.Text)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s - %s", pri,
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(s.Hostname, 255), headerField(s.AppName, 48),
+		headerField(s.ProcID, 128), headerField(s.MsgID, 32), line.Text)
+}
+
+// headerField returns s as a syslog header field: "-" when empty,
+// otherwise with characters other than printable ASCII replaced with
+// "_", and truncated to max.
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
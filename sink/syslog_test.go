@@ -0,0 +1,305 @@
+package sink
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+func testLine(text string) *tail.Line {
+	return &tail.Line{Text: text, Time: time.Date(2015, 3, 4, 5, 6, 7, 8000, time.UTC)}
+}
+
+func TestSyslogFormat(t *testing.T) {
+	s := &Syslog{Facility: Local4, Severity: Warning, Hostname: "web 1", AppName: "app", ProcID: "42"}
+	expected := "<164>1 2015-03-04T05:06:07.000008Z web_1 app 42 - - hello"
+	if msg := s.format(testLine("hello")); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+	s.Format = RFC3164
+	expected = "<164>Mar  4 05:06:07 web_1 app[42]: hello"
+	if msg := s.format(testLine("hello")); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+func TestSyslogFormatEventTime(t *testing.T) {
+	s := &Syslog{Hostname: "web1", AppName: "app"}
+	line := testLine("hello")
+	line.EventTime = time.Date(2015, 3, 4, 4, 0, 0, 0, time.UTC)
+	expected := "<0>1 2015-03-04T04:00:00.000000Z web1 app - - - hello"
+	if msg := s.format(line); msg != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+// readFrame reads an octet-counted syslog message.
+func readFrame(r *bufio.Reader) (string, error) {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	return string(msg), err
+}
+
+func expectMessage(t *testing.T, msg, text string) {
+	if !strings.HasPrefix(msg, "<14>1 ") || !strings.HasSuffix(msg, " - - "+text) {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := NewSyslog("udp", conn.LocalAddr().String())
+	s.ProcID = ""
+	defer s.Close()
+
+	if err := s.Write(testLine("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "<14>1 ") || !strings.HasSuffix(string(buf[:n]), " - - hello") {
+		t.Errorf("unexpected message %q", buf[:n])
+	}
+}
+
+func TestSyslogTCPReconnects(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := NewSyslog("tcp", l.Addr().String())
+	s.ProcID = ""
+	defer s.Close()
+
+	if err := s.Write(testLine("first")); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := readFrame(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, msg, "first")
+
+	// The server hangs up: the next lines are sent on a new
+	// connection, although one may be lost in the closed one.
+	conn.Close()
+	done := make(chan error)
+	go func() {
+		for _, text := range []string{"second", "third", "fourth"} {
+			if err := s.Write(testLine(text)); err != nil {
+				done <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		done <- nil
+	}()
+	conn, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if msg, err = readFrame(bufio.NewReader(conn)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(msg, " second") && !strings.HasSuffix(msg, " third") {
+		t.Errorf("unexpected message after reconnecting %q", msg)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	s := NewSyslog("tls", l.Addr().String())
+	s.ProcID = ""
+	s.TLSConfig = &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	defer s.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		msg, err := readFrame(bufio.NewReader(conn))
+		if err != nil {
+			msg = err.Error()
+		}
+		received <- msg
+	}()
+	if err := s.Write(testLine("secret")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, <-received, "secret")
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestSyslogCloseUnblocksWrite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewSyslog("tcp", addr)
+	done := make(chan error)
+	go func() {
+		done <- s.Write(testLine("lost"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestSyslogCloseWhileDialing(t *testing.T) {
+	// The TLS handshake never completes.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	s := NewSyslog("tls", l.Addr().String())
+	s.Timeout = time.Second
+	done := make(chan error)
+	go func() {
+		done <- s.Write(testLine("lost"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan bool)
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected Close not to wait for dialing")
+	}
+	if err := <-done; err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+// collector is a Sink collecting lines.
+type collector struct {
+	lines  []string
+	closed bool
+}
+
+func (c *collector) Write(line *tail.Line) error {
+	c.lines = append(c.lines, line.Text)
+	return nil
+}
+
+func (c *collector) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.log")
+	ioutil.WriteFile(filename, []byte("a\nb\n"), 0600)
+
+	tl, err := tail.TailFile(filename, tail.Config{Ack: true, Logger: tail.DiscardingLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	if err := Run(tl, c); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.lines, ",") != "a,b" || !c.closed {
+		t.Errorf("unexpected lines %q, or sink not closed", c.lines)
+	}
+	if checkpoint := tl.Checkpoint(); checkpoint != 4 {
+		t.Errorf("expected the written lines to be acknowledged, got checkpoint %d", checkpoint)
+	}
+}
@@ -0,0 +1,799 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// Package spool implements a durable queue of lines on disk, to keep
+// tailing files while a slow or unavailable sink catches up.
+//
+//	s, err := spool.Open("/var/spool/app", spool.Config{MaxSize: 1 << 30})
+//	...
+//	go sink.Run(t, s) // Fill the spool from the tail
+//	err = spool.Drain(s, syslog)
+//
+// Lines are appended to segment files. Read returns them in order, and
+// Ack records that they were delivered: after a restart, reading
+// resumes with the first line not acknowledged. Segments are deleted
+// once all their lines are acknowledged.
+//
+// Unless with SyncAlways, acknowledgements are saved every
+// Config.SyncInterval and on Close, rather than for every line: after
+// a crash, the lines acknowledged since are read again.
+//
+// Segments start with a header recording the version of the format of
+// their lines, so that spools written by older versions of the package
+// are still read, and newer ones are refused rather than skipped as
+// corrupted.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/hpcloud/tail/sink"
+	"gopkg.in/tomb.v1"
+)
+
+// ErrClosed is returned by operations on a closed Spool.
+var ErrClosed = errors.New("spool: closed")
+
+// SyncPolicy is when a Spool flushes writes to stable storage.
+type SyncPolicy int
+
+const (
+	SyncNone     SyncPolicy = iota // Leave it to the operating system
+	SyncAlways                     // After every line and acknowledgement
+	SyncPeriodic                   // Every Config.SyncInterval
+)
+
+// FullPolicy is what writing to a full Spool does.
+type FullPolicy int
+
+const (
+	Block      FullPolicy = iota // Wait for lines to be acknowledged
+	DropOldest                   // Delete the oldest segments, acknowledged or not
+)
+
+// Config configures a Spool.
+type Config struct {
+	// SegmentSize is the size above which a new segment file is
+	// started; DEFAULT_SEGMENT_SIZE when zero.
+	SegmentSize int64
+
+	// MaxSize caps the total size of the lines in segment files, if
+	// non-zero. What happens when it is reached is set by Full.
+	MaxSize int64
+	Full    FullPolicy
+
+	Sync         SyncPolicy
+	SyncInterval time.Duration // Of SyncPeriodic, and saving acknowledgements; one second when zero
+}
+
+// DEFAULT_SEGMENT_SIZE is the default Config.SegmentSize.
+var DEFAULT_SEGMENT_SIZE int64 = 64 << 20
+
+const (
+	segmentExt = ".seg"
+	ackFile    = "ack"
+	headerSize = 8  // Payload length and CRC-32
+	fixedSize  = 48 // Offsets, times, repeats and text size of a line
+
+	// segmentMagic, followed by the format version, starts segments.
+	// Segments without it are of version 0: lines of fixedSize0, with
+	// only their offset and time, from the start of the file.
+	segmentMagic      = "tailspl"
+	segmentHeaderSize = len(segmentMagic) + 1
+	formatVersion     = 1
+	fixedSize0        = 16
+)
+
+// position is a position in the spool, at the start or end of a line.
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+func (p position) before(q position) bool {
+	return p.segment < q.segment || (p.segment == q.segment && p.offset < q.offset)
+}
+
+type segment struct {
+	id      uint64
+	size    int64
+	version byte
+}
+
+// start returns the offset of the first line of seg.
+func (seg *segment) start() int64 {
+	if seg.version == 0 {
+		return 0
+	}
+	return int64(segmentHeaderSize)
+}
+
+// lines returns the size of the lines of seg.
+func (seg *segment) lines() int64 {
+	return seg.size - seg.start()
+}
+
+// Entry is a line read from a Spool, to acknowledge with Ack.
+type Entry struct {
+	Line *tail.Line
+	end  position
+}
+
+// Spool is a durable queue of lines. It is a sink.Sink, and is safe
+// for concurrent use.
+type Spool struct {
+	dir    string
+	config Config
+
+	mux      sync.Mutex
+	cond     *sync.Cond
+	segments []*segment // Oldest first; the last one is written to
+	size     int64
+	w        *os.File
+	dirty    bool     // Written since the last sync
+	ackDirty bool     // Acknowledged since the last save
+	r        *os.File // Segment being read
+	rID      uint64
+	read     position // Next line to read
+	acked    position // Next line to acknowledge
+	closed   bool
+	syncer   tomb.Tomb
+}
+
+// Open opens the spool in dir, creating it if needed.
+func Open(dir string, config Config) (*Spool, error) {
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DEFAULT_SEGMENT_SIZE
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, config: config}
+	s.cond = sync.NewCond(&s.mux)
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	if config.Sync != SyncAlways {
+		go s.syncPeriodically()
+	} else {
+		s.syncer.Done()
+	}
+	return s, nil
+}
+
+// load finds the segments and the acknowledged position, and prepares
+// the last segment for writing.
+func (s *Spool) load() error {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		name := fi.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		seg := &segment{id: id, size: fi.Size()}
+		if seg.version, err = readVersion(s.path(id)); err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	if err := s.loadAck(); err != nil {
+		return err
+	}
+	// Delete the segments acknowledged before a crash.
+	for len(s.segments) > 0 && s.segments[0].id < s.acked.segment {
+		if err := os.Remove(s.path(s.segments[0].id)); err != nil {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = []*segment{{id: s.acked.segment}}
+	}
+	last := s.segments[len(s.segments)-1]
+	if s.w, err = os.OpenFile(s.path(last.id), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return err
+	}
+	if last.size == 0 {
+		if err := writeHeader(s.w); err != nil {
+			return err
+		}
+		last.version, last.size = formatVersion, int64(segmentHeaderSize)
+	}
+	// Drop a line partially written before a crash.
+	if last.size, err = validSize(s.w, last); err != nil {
+		return err
+	}
+	if err := s.w.Truncate(last.size); err != nil {
+		return err
+	}
+	if _, err := s.w.Seek(last.size, os.SEEK_SET); err != nil {
+		return err
+	}
+
+	for _, seg := range s.segments {
+		s.size += seg.lines()
+	}
+	if s.acked.segment < s.segments[0].id {
+		s.acked = position{s.segments[0].id, 0}
+	}
+	s.read = s.acked
+	return nil
+}
+
+func (s *Spool) loadAck() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, ackFile))
+	if os.IsNotExist(err) {
+		if len(s.segments) > 0 {
+			s.acked.segment = s.segments[0].id
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(string(data), "%x %d", &s.acked.segment, &s.acked.offset); err != nil {
+		return fmt.Errorf("spool: invalid %s: %s", ackFile, err)
+	}
+	return nil
+}
+
+// saveAck atomically records the acknowledged position.
+func (s *Spool) saveAck() error {
+	path := filepath.Join(s.dir, ackFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%x %d\n", s.acked.segment, s.acked.offset)
+	if err == nil && s.config.Sync == SyncAlways {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readVersion returns the format version of the segment at path.
+func readVersion(path string) (byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var header [segmentHeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil || string(header[:len(segmentMagic)]) != segmentMagic {
+		return 0, nil
+	}
+	version := header[len(segmentMagic)]
+	if version > formatVersion {
+		return 0, fmt.Errorf("spool: %s has format version %d, newer than %d", path, version, formatVersion)
+	}
+	return version, nil
+}
+
+// writeHeader writes the header of a new segment to f.
+func writeHeader(f *os.File) error {
+	_, err := f.Write(append([]byte(segmentMagic), formatVersion))
+	return err
+}
+
+// validSize returns the size of the header and the complete,
+// uncorrupted lines at the start of f, the file of seg.
+func validSize(f *os.File, seg *segment) (int64, error) {
+	if _, err := f.Seek(seg.start(), os.SEEK_SET); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	size := seg.start()
+	for {
+		_, n, err := readLine(r, seg.version)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || err == errCorrupt {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+}
+
+func (s *Spool) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+// Write appends a line to the spool. When the spool is full, it blocks
+// until lines are acknowledged, or deletes the oldest segments, as set
+// by Config.Full.
+func (s *Spool) Write(line *tail.Line) error {
+	data := encodeLine(line)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for !s.closed && s.config.MaxSize > 0 && s.size+int64(len(data)) > s.config.MaxSize {
+		if s.config.Full == DropOldest && s.size > 0 {
+			if len(s.segments) == 1 {
+				// Start a new segment to drop the only one.
+				if err := s.rotate(); err != nil {
+					return err
+				}
+			}
+			if err := s.dropOldest(); err != nil {
+				return err
+			}
+			continue
+		}
+		if last := s.segments[len(s.segments)-1]; last.lines() > 0 && s.acked == (position{last.id, last.size}) {
+			// Everything was acknowledged: start a new segment
+			// to delete the current one.
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			if err := s.deleteAcked(); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.size == 0 {
+			break // A line larger than MaxSize
+		}
+		s.cond.Wait()
+	}
+	if s.closed {
+		return ErrClosed
+	}
+
+	last := s.segments[len(s.segments)-1]
+	if last.size >= s.config.SegmentSize || last.version != formatVersion {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		if err := s.deleteAcked(); err != nil {
+			return err
+		}
+		last = s.segments[len(s.segments)-1]
+	}
+	if _, err := s.w.Write(data); err != nil {
+		// Do not leave a partial line behind.
+		s.w.Truncate(last.size)
+		s.w.Seek(last.size, os.SEEK_SET)
+		return err
+	}
+	last.size += int64(len(data))
+	s.size += int64(len(data))
+	if s.config.Sync == SyncAlways {
+		if err := s.w.Sync(); err != nil {
+			return err
+		}
+	}
+	s.dirty = true
+	s.cond.Broadcast()
+	return nil
+}
+
+// rotate starts a new segment.
+func (s *Spool) rotate() error {
+	if s.config.Sync != SyncNone {
+		if err := s.w.Sync(); err != nil {
+			return err
+		}
+	}
+	id := s.segments[len(s.segments)-1].id + 1
+	w, err := os.OpenFile(s.path(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeHeader(w); err != nil {
+		w.Close()
+		return err
+	}
+	s.w.Close()
+	s.w = w
+	s.segments = append(s.segments, &segment{id, int64(segmentHeaderSize), formatVersion})
+	return nil
+}
+
+// dropOldest deletes the oldest segment, moving the read and
+// acknowledged positions past it.
+func (s *Spool) dropOldest() error {
+	oldest := s.segments[0]
+	if s.r != nil && s.rID == oldest.id {
+		s.r.Close()
+		s.r = nil
+	}
+	if err := os.Remove(s.path(oldest.id)); err != nil {
+		return err
+	}
+	s.segments = s.segments[1:]
+	s.size -= oldest.lines()
+	next := position{s.segments[0].id, 0}
+	if s.acked.before(next) {
+		s.acked = next
+		if err := s.saveAck(); err != nil {
+			return err
+		}
+	}
+	if s.read.before(next) {
+		s.read = next
+	}
+	return nil
+}
+
+// Read returns the next line, blocking until one is written or the
+// spool is closed. Lines read but not acknowledged are read again
+// after the spool is reopened.
+func (s *Spool) Read() (*Entry, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for {
+		if s.closed {
+			return nil, ErrClosed
+		}
+		seg := s.segment(s.read.segment)
+		if seg == nil {
+			return nil, fmt.Errorf("spool: missing segment %x", s.read.segment)
+		}
+		if s.read.offset < seg.start() {
+			s.read.offset = seg.start()
+		}
+		if s.read.offset < seg.size {
+			entry, err := s.readAt(seg)
+			if err != errCorrupt {
+				return entry, err
+			}
+			// Skip the rest of a corrupted segment.
+			s.read.offset = seg.size
+			continue
+		}
+		if seg != s.segments[len(s.segments)-1] {
+			s.read = position{seg.id + 1, 0}
+			continue
+		}
+		s.cond.Wait()
+	}
+}
+
+// unread moves the read position back to the first line not
+// acknowledged, to read the lines after it again.
+func (s *Spool) unread() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.read = s.acked
+}
+
+func (s *Spool) segment(id uint64) *segment {
+	for _, seg := range s.segments {
+		if seg.id == id {
+			return seg
+		}
+	}
+	return nil
+}
+
+// readAt reads the line at the read position, in seg.
+func (s *Spool) readAt(seg *segment) (*Entry, error) {
+	if s.r == nil || s.rID != seg.id {
+		if s.r != nil {
+			s.r.Close()
+			s.r = nil
+		}
+		r, err := os.Open(s.path(seg.id))
+		if err != nil {
+			return nil, err
+		}
+		s.r, s.rID = r, seg.id
+	}
+	r := io.NewSectionReader(s.r, s.read.offset, seg.size-s.read.offset)
+	line, n, err := readLine(r, seg.version)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errCorrupt
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.read.offset += n
+	return &Entry{line, s.read}, nil
+}
+
+// Ack acknowledges that the line of e, and all the lines read before
+// it, were delivered.
+func (s *Spool) Ack(e *Entry) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if !s.acked.before(e.end) {
+		return nil
+	}
+	s.acked = e.end
+	// Writes blocked on a full spool may reclaim the last segment.
+	s.cond.Broadcast()
+	if s.config.Sync == SyncAlways {
+		if err := s.saveAck(); err != nil {
+			return err
+		}
+	} else {
+		s.ackDirty = true
+	}
+	return s.deleteAcked()
+}
+
+// deleteAcked deletes the segments whose lines were all acknowledged,
+// except the one written to.
+func (s *Spool) deleteAcked() error {
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if oldest.id > s.acked.segment ||
+			(oldest.id == s.acked.segment && s.acked.offset < oldest.size) {
+			break
+		}
+		if s.r != nil && s.rID == oldest.id {
+			s.r.Close()
+			s.r = nil
+		}
+		if err := os.Remove(s.path(oldest.id)); err != nil {
+			return err
+		}
+		s.segments = s.segments[1:]
+		s.size -= oldest.lines()
+		s.cond.Broadcast()
+	}
+	if first := (position{s.segments[0].id, 0}); s.read.before(first) {
+		s.read = first
+	}
+	return nil
+}
+
+// Len returns the total size of the lines in the spool, in bytes.
+func (s *Spool) Len() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.size
+}
+
+// Close closes the spool, unblocking pending reads and writes.
+func (s *Spool) Close() error {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.mux.Unlock()
+
+	s.syncer.Kill(nil)
+	s.syncer.Wait()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var err error
+	if s.config.Sync != SyncNone && s.w != nil {
+		err = s.w.Sync()
+	}
+	if s.ackDirty {
+		if aerr := s.saveAck(); err == nil {
+			err = aerr
+		}
+		s.ackDirty = false
+	}
+	if cerr := s.closeFiles(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Spool) closeFiles() error {
+	var err error
+	if s.w != nil {
+		err = s.w.Close()
+		s.w = nil
+	}
+	if s.r != nil {
+		s.r.Close()
+		s.r = nil
+	}
+	return err
+}
+
+// syncPeriodically syncs writes with SyncPeriodic, and saves
+// acknowledgements, every SyncInterval.
+func (s *Spool) syncPeriodically() {
+	defer s.syncer.Done()
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mux.Lock()
+			if s.dirty && !s.closed && s.config.Sync == SyncPeriodic {
+				s.w.Sync()
+				s.dirty = false
+			}
+			if s.ackDirty && !s.closed && s.saveAck() == nil {
+				s.ackDirty = false
+			}
+			s.mux.Unlock()
+		case <-s.syncer.Dying():
+			return
+		}
+	}
+}
+
+// Drain writes the lines of s to dst, acknowledging them once written,
+// until s is closed or dst fails. The line dst failed to write is read
+// again by the next Drain.
+func Drain(s *Spool, dst sink.Sink) error {
+	for {
+		e, err := s.Read()
+		if err == ErrClosed {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := dst.Write(e.Line); err != nil {
+			s.unread()
+			return err
+		}
+		if err := s.Ack(e); err != nil && err != ErrClosed {
+			return err
+		}
+	}
+}
+
+var errCorrupt = errors.New("spool: corrupted line")
+
+// encodeLine encodes a line as its payload size, the CRC-32 of its
+// payload, and the payload: the offset, end, time, event time, last time,
+// repeats and text size of the line, its text, and its fields as
+// sized keys and values.
+func encodeLine(line *tail.Line) []byte {
+	data := make([]byte, headerSize+fixedSize, headerSize+fixedSize+len(line.Text))
+	payload := data[headerSize:]
+	binary.BigEndian.PutUint64(payload[0:], uint64(line.Offset))
+	binary.BigEndian.PutUint64(payload[8:], uint64(line.End))
+	binary.BigEndian.PutUint64(payload[16:], uint64(encodeTime(line.Time)))
+	binary.BigEndian.PutUint64(payload[24:], uint64(encodeTime(line.EventTime)))
+	binary.BigEndian.PutUint64(payload[32:], uint64(encodeTime(line.LastTime)))
+	binary.BigEndian.PutUint32(payload[40:], uint32(line.Repeats))
+	binary.BigEndian.PutUint32(payload[44:], uint32(len(line.Text)))
+	data = append(data, line.Text...)
+	keys := make([]string, 0, len(line.Fields))
+	for k := range line.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data = appendString(data, k)
+		data = appendString(data, line.Fields[k])
+	}
+	binary.BigEndian.PutUint32(data[0:], uint32(len(data)-headerSize))
+	binary.BigEndian.PutUint32(data[4:], crc32.ChecksumIEEE(data[headerSize:]))
+	return data
+}
+
+func appendString(data []byte, s string) []byte {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(s)))
+	return append(append(data, size[:]...), s...)
+}
+
+// readString reads a string appended by appendString to data, and
+// returns the rest.
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errCorrupt
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint64(size) > uint64(len(data)-4) {
+		return "", nil, errCorrupt
+	}
+	return string(data[4 : 4+size]), data[4+size:], nil
+}
+
+// readLine decodes a line of a segment of the given format version,
+// and returns its encoded size.
+func readLine(r io.Reader, version byte) (*tail.Line, int64, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:])
+	if size < fixedSize0 || size > 1<<30 {
+		return nil, 0, errCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, errCorrupt
+	}
+	if version == 0 {
+		return &tail.Line{
+			Offset: int64(binary.BigEndian.Uint64(payload[0:])),
+			Time:   time.Unix(0, int64(binary.BigEndian.Uint64(payload[8:]))),
+			Text:   string(payload[fixedSize0:]),
+		}, int64(headerSize + size), nil
+	}
+	if size < fixedSize {
+		return nil, 0, errCorrupt
+	}
+	text := binary.BigEndian.Uint32(payload[44:])
+	if text > size-fixedSize {
+		return nil, 0, errCorrupt
+	}
+	line := &tail.Line{
+		Offset:    int64(binary.BigEndian.Uint64(payload[0:])),
+		End:       int64(binary.BigEndian.Uint64(payload[8:])),
+		Time:      decodeTime(int64(binary.BigEndian.Uint64(payload[16:]))),
+		EventTime: decodeTime(int64(binary.BigEndian.Uint64(payload[24:]))),
+		LastTime:  decodeTime(int64(binary.BigEndian.Uint64(payload[32:]))),
+		Repeats:   int(binary.BigEndian.Uint32(payload[40:])),
+		Text:      string(payload[fixedSize : fixedSize+text]),
+	}
+	for fields := payload[fixedSize+text:]; len(fields) > 0; {
+		var k, v string
+		var err error
+		if k, fields, err = readString(fields); err != nil {
+			return nil, 0, err
+		}
+		if v, fields, err = readString(fields); err != nil {
+			return nil, 0, err
+		}
+		if line.Fields == nil {
+			line.Fields = make(map[string]string)
+		}
+		line.Fields[k] = v
+	}
+	return line, int64(headerSize + size), nil
+}
+
+// encodeTime returns t in nanoseconds since the Unix epoch, or 0 for
+// the zero time.
+func encodeTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func decodeTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
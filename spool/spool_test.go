@@ -0,0 +1,377 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+func newTestSpool(t *testing.T, config Config) (*Spool, string) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir, config)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func writeLines(t *testing.T, s *Spool, texts ...string) {
+	for _, text := range texts {
+		if err := s.Write(&tail.Line{Text: text, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readLines reads n lines, acknowledging them if ack is set.
+func readLines(t *testing.T, s *Spool, n int, ack bool) []string {
+	var texts []string
+	for i := 0; i < n; i++ {
+		e, err := s.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, e.Line.Text)
+		if ack {
+			if err := s.Ack(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return texts
+}
+
+func expectLines(t *testing.T, got []string, expected ...string) {
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected lines %q, got %q", expected, got)
+	}
+}
+
+func segmentCount(t *testing.T, dir string) int {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(matches)
+}
+
+func TestSpoolResumesAtAck(t *testing.T) {
+	s, dir := newTestSpool(t, Config{SegmentSize: 140, Sync: SyncAlways})
+	defer os.RemoveAll(dir)
+
+	line := &tail.Line{Text: "first", Offset: 42, End: 48, Time: time.Unix(0, 123),
+		EventTime: time.Unix(0, 456), Repeats: 3, LastTime: time.Unix(0, 789),
+		Fields: map[string]string{"host": "web1", "env": ""}}
+	if err := s.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Line.Text != "first" || e.Line.Offset != 42 || e.Line.End != 48 || e.Line.Repeats != 3 || !e.Line.Time.Equal(line.Time) ||
+		!e.Line.EventTime.Equal(line.EventTime) || !e.Line.LastTime.Equal(line.LastTime) ||
+		fmt.Sprint(e.Line.Fields) != fmt.Sprint(line.Fields) {
+		t.Errorf("expected %+v, got %+v", line, e.Line)
+	}
+	s.Ack(e)
+
+	writeLines(t, s, "second", "third", "fourth", "fifth")
+	expectLines(t, readLines(t, s, 2, true), "second", "third")
+	expectLines(t, readLines(t, s, 1, false), "fourth")
+	if n := segmentCount(t, dir); n != 1 {
+		t.Errorf("expected the acknowledged segments to be deleted, leaving 1, got %d", n)
+	}
+	s.Close()
+
+	// Lines not acknowledged are read again.
+	if s, err = Open(dir, Config{SegmentSize: 140}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	expectLines(t, readLines(t, s, 2, true), "fourth", "fifth")
+	writeLines(t, s, "sixth")
+	expectLines(t, readLines(t, s, 1, true), "sixth")
+}
+
+func TestSpoolDropsPartialLine(t *testing.T) {
+	s, dir := newTestSpool(t, Config{})
+	defer os.RemoveAll(dir)
+	writeLines(t, s, "complete")
+	s.Close()
+
+	// Simulate a crash while writing a line.
+	f, err := os.OpenFile(s.path(0), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(encodeLine(&tail.Line{Text: "partial"})[:12])
+	f.Close()
+
+	if s, err = Open(dir, Config{}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	writeLines(t, s, "next")
+	expectLines(t, readLines(t, s, 2, true), "complete", "next")
+}
+
+func TestSpoolReadsVersion0(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A segment written before segments had a header.
+	var data []byte
+	for i, text := range []string{"old", "older"} {
+		line := make([]byte, headerSize+fixedSize0+len(text))
+		binary.BigEndian.PutUint32(line[0:], uint32(fixedSize0+len(text)))
+		binary.BigEndian.PutUint64(line[8:], uint64(10*i))
+		binary.BigEndian.PutUint64(line[16:], uint64(time.Unix(0, 123).UnixNano()))
+		copy(line[headerSize+fixedSize0:], text)
+		binary.BigEndian.PutUint32(line[4:], crc32.ChecksumIEEE(line[headerSize:]))
+		data = append(data, line...)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "0000000000000000"+segmentExt), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// New lines go to a new segment.
+	s, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	writeLines(t, s, "new")
+	e, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Line.Text != "old" || e.Line.Offset != 0 || !e.Line.Time.Equal(time.Unix(0, 123)) {
+		t.Errorf("expected old at 0, got %+v", e.Line)
+	}
+	s.Ack(e)
+	expectLines(t, readLines(t, s, 2, true), "older", "new")
+}
+
+func TestSpoolRefusesNewerVersion(t *testing.T) {
+	s, dir := newTestSpool(t, Config{})
+	defer os.RemoveAll(dir)
+	writeLines(t, s, "line")
+	s.Close()
+
+	f, err := os.OpenFile(s.path(0), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{formatVersion + 1}, int64(len(segmentMagic)))
+	f.Close()
+	if s, err = Open(dir, Config{}); err == nil {
+		s.Close()
+		t.Error("expected an error opening a spool of a newer format")
+	}
+}
+
+func TestSpoolFullBlocks(t *testing.T) {
+	size := int64(len(encodeLine(&tail.Line{Text: "line0"})))
+	s, dir := newTestSpool(t, Config{SegmentSize: size, MaxSize: 2 * size})
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	writeLines(t, s, "line0", "line1")
+
+	written := make(chan bool)
+	go func() {
+		writeLines(t, s, "line2")
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("expected writing to a full spool to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectLines(t, readLines(t, s, 1, true), "line0")
+	<-written
+	expectLines(t, readLines(t, s, 2, true), "line1", "line2")
+
+	// Once everything is acknowledged, the last segment is deleted
+	// as well to make room.
+	writeLines(t, s, "line3", "line4")
+	expectLines(t, readLines(t, s, 2, true), "line3", "line4")
+}
+
+func TestSpoolFullDropsOldest(t *testing.T) {
+	size := int64(len(encodeLine(&tail.Line{Text: "line0"})))
+	s, dir := newTestSpool(t, Config{SegmentSize: size, MaxSize: 2 * size, Full: DropOldest})
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	writeLines(t, s, "line0", "line1", "line2", "line3")
+	if s.Len() != 2*size {
+		t.Errorf("expected the spool to be capped to %d bytes, got %d", 2*size, s.Len())
+	}
+	expectLines(t, readLines(t, s, 2, true), "line2", "line3")
+}
+
+func TestSpoolFullBlocksInOneSegment(t *testing.T) {
+	size := int64(len(encodeLine(&tail.Line{Text: "line0"})))
+	s, dir := newTestSpool(t, Config{MaxSize: 3 * size})
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	writeLines(t, s, "line0", "line1", "line2")
+
+	written := make(chan bool)
+	go func() {
+		writeLines(t, s, "line3")
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("expected writing to a full spool to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectLines(t, readLines(t, s, 3, true), "line0", "line1", "line2")
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected acknowledging the whole segment to unblock writing")
+	}
+	expectLines(t, readLines(t, s, 1, true), "line3")
+	if s.Len() != size {
+		t.Errorf("expected the acknowledged segment to be deleted, got %d bytes", s.Len())
+	}
+}
+
+func TestSpoolFullDropsOldestInOneSegment(t *testing.T) {
+	size := int64(len(encodeLine(&tail.Line{Text: "line0"})))
+	s, dir := newTestSpool(t, Config{MaxSize: 3 * size, Full: DropOldest})
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	done := make(chan bool)
+	go func() {
+		writeLines(t, s, "line0", "line1", "line2", "line3", "line4")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected writing to a full spool not to block")
+	}
+	if s.Len() > 3*size {
+		t.Errorf("expected the spool to be capped to %d bytes, got %d", 3*size, s.Len())
+	}
+	expectLines(t, readLines(t, s, 2, true), "line3", "line4")
+}
+
+func TestSpoolCloseUnblocksRead(t *testing.T) {
+	s, dir := newTestSpool(t, Config{Sync: SyncPeriodic, SyncInterval: time.Millisecond})
+	defer os.RemoveAll(dir)
+	done := make(chan error)
+	go func() {
+		_, err := s.Read()
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+// collector is a sink.Sink collecting lines.
+type collector struct {
+	lines chan string
+}
+
+func (c *collector) Write(line *tail.Line) error {
+	c.lines <- line.Text
+	return nil
+}
+
+func (c *collector) Close() error {
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	s, dir := newTestSpool(t, Config{})
+	defer os.RemoveAll(dir)
+	c := &collector{make(chan string)}
+	done := make(chan error)
+	go func() {
+		done <- Drain(s, c)
+	}()
+	writeLines(t, s, "a", "b")
+	expectLines(t, []string{<-c.lines, <-c.lines}, "a", "b")
+	s.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingSink is a sink.Sink failing to write the lines after the
+// first n.
+type failingSink struct {
+	collector
+	n int
+}
+
+func (f *failingSink) Write(line *tail.Line) error {
+	if f.n == 0 {
+		return errors.New("unavailable")
+	}
+	f.n--
+	return f.collector.Write(line)
+}
+
+func TestDrainRetriesFailedLine(t *testing.T) {
+	s, dir := newTestSpool(t, Config{})
+	defer os.RemoveAll(dir)
+	writeLines(t, s, "a", "b", "c")
+
+	f := &failingSink{collector{make(chan string, 3)}, 1}
+	if err := Drain(s, f); err == nil {
+		t.Fatal("expected the error of the sink")
+	}
+	expectLines(t, []string{<-f.lines}, "a")
+
+	// The line that failed is written by the next Drain.
+	f.n = 3
+	done := make(chan error)
+	go func() {
+		done <- Drain(s, f)
+	}()
+	expectLines(t, []string{<-f.lines, <-f.lines}, "b", "c")
+	s.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolSavesAcksPeriodically(t *testing.T) {
+	s, dir := newTestSpool(t, Config{SyncInterval: time.Hour})
+	defer os.RemoveAll(dir)
+	writeLines(t, s, "a", "b")
+	readLines(t, s, 1, true)
+	if _, err := os.Stat(filepath.Join(dir, ackFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the acknowledgement not to be saved yet, got %v", err)
+	}
+	// Close saves it.
+	s.Close()
+	if s, err := Open(dir, Config{}); err != nil {
+		t.Fatal(err)
+	} else {
+		defer s.Close()
+		expectLines(t, readLines(t, s, 1, true), "b")
+	}
+}
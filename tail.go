@@ -17,6 +17,7 @@ import (
 
 	"github.com/hpcloud/tail/ratelimiter"
 	"github.com/hpcloud/tail/util"
+	"github.com/hpcloud/tail/vfs"
 	"github.com/hpcloud/tail/watch"
 	"gopkg.in/tomb.v1"
 )
@@ -26,14 +27,35 @@ var (
 )
 
 type Line struct {
-	Text string
-	Time time.Time
-	Err  error // Error from tail
+	Text   string
+	Time   time.Time // When the line was read
+	Err    error     // Error from tail
+	Offset int64     // Offset of the line in the file, or in the reader's stream
+
+	// End is the position just past the line, and its newline, from
+	// which tailing again resumes with the next line. Parts of a line
+	// split by MaxLineSize end where the next part starts, and lines
+	// output by processors where the line they were made of ends.
+	End int64
+
+	// EventTime is the time written in the line, read by
+	// Config.TimeParser. Lines without one, such as the continuation
+	// of a multi-line message, have that of the line before them.
+	EventTime time.Time
+
+	// Repeats is the number of repeats of the line collapsed into it
+	// by Config.Dedup, the last of which was read at LastTime.
+	Repeats  int
+	LastTime time.Time
+
+	Fields map[string]string // Set by processors, eg: AddFields
+
+	ack *ackEntry // With Config.Ack
 }
 
 // NewLine returns a Line with present time.
 func NewLine(text string) *Line {
-	return &Line{text, time.Now(), nil}
+	return &Line{Text: text, Time: time.Now()}
 }
 
 // SeekInfo represents arguments to `os.Seek`
@@ -57,17 +79,56 @@ type logger interface {
 // Config is used to specify how a file must be tailed.
 type Config struct {
 	// File-specifc
-	Location    *SeekInfo // Seek to this location before tailing
-	ReOpen      bool      // Reopen recreated files (tail -F)
-	MustExist   bool      // Fail early if the file does not exist
-	Poll        bool      // Poll for file changes instead of using inotify
-	Pipe        bool      // Is a named pipe (mkfifo)
-	RateLimiter *ratelimiter.LeakyBucket
+	Location     *SeekInfo // Seek to this location before tailing
+	LocationTime time.Time // Or to the first line at or after this time
+	ReOpen       bool      // Reopen recreated files (tail -F)
+	MustExist    bool      // Fail early if the file does not exist
+	Poll         bool      // Poll for file changes instead of using inotify
+	PollFallback bool      // Use inotify, but fall back to polling when it fails
+	Pipe         bool      // Is a named pipe (mkfifo)
+	RateLimiter  *ratelimiter.LeakyBucket
+
+	// Polling intervals, used with Poll or PollFallback.
+	// PollInterval defaults to watch.POLL_DURATION. When MaxPollInterval
+	// is greater, idle files are polled less and less often, up to
+	// MaxPollInterval, until they change again.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+
+	// NewWatcher, when set, creates the watcher used to detect changes
+	// to the file, instead of the inotify or polling watchers selected
+	// by Poll and PollFallback.
+	NewWatcher func(filename string) watch.FileWatcher
+
+	// FS is the filesystem the file is opened and stat'ed from; vfs.OS
+	// when nil. Unless NewWatcher is set, files of a vfs.Notifier (eg:
+	// vfs.MemFS) are watched through its events, and those of other
+	// filesystems are polled.
+	FS vfs.FS
 
 	// Generic IO
 	Follow      bool // Continue looking for new lines (tail -f)
 	MaxLineSize int  // If non-zero, split longer lines into multiple lines
 
+	// TimeParser reads the time of lines into Line.EventTime, eg: a
+	// TimeExtractor. With LocationTime, it is also used to
+	// binary-search the file, whose line times must increase.
+	TimeParser TimeParser
+
+	// Processors are run in turn on lines before they are sent to
+	// Lines, to change, drop or split them.
+	Processors []*Processor
+
+	// Dedup, when set, collapses runs of repeated lines. With a named
+	// pipe or TailReader, a run held back longer than its MaxWindow
+	// is only sent once the next line is read.
+	Dedup *Dedup
+
+	// Ack makes lines be acknowledged with Line.Ack once consumed, eg:
+	// by a sink, for Checkpoint to return where to resume from
+	// without losing lines.
+	Ack bool
+
 	// Logger, when nil, is set to tail.DefaultLogger
 	// To disable logging: set field to tail.DiscardingLogger
 	Logger logger
@@ -78,9 +139,32 @@ type Tail struct {
 	Lines    chan *Line
 	Config
 
-	file   *os.File
+	file   vfs.File
 	reader *bufio.Reader
 
+	// offset is the position in the file of the next byte read from
+	// reader, and delivered the position just past the last line sent
+	// to Lines, as returned by Tell.
+	offset    int64
+	delivered int64
+
+	acks *ackTracker // With Ack, replaced along with offset
+
+	// requests to Pause, Resume or Seek, handled by the goroutine
+	// reading the file, which sets paused and seeked.
+	requests chan *request
+	paused   bool
+	seeked   bool
+
+	eventTime time.Time // Of the last line with one
+
+	// held is the line collapsing a run of repeats with Dedup, heldKey
+	// what lines are compared to it by, and heldEnd the position past
+	// its last repeat.
+	held    *Line
+	heldKey string
+	heldEnd int64
+
 	watcher watch.FileWatcher
 	changes *watch.FileChanges
 
@@ -109,22 +193,29 @@ func TailFile(filename string, config Config) (*Tail, error) {
 		Filename: filename,
 		Lines:    make(chan *Line),
 		Config:   config,
+		requests: make(chan *request),
 	}
+	t.resetAcks(0)
 
 	// when Logger was not specified in config, use default logger
 	if t.Logger == nil {
 		t.Logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
 
-	if t.Poll {
-		t.watcher = watch.NewPollingFileWatcher(filename)
-	} else {
-		t.watcher = watch.NewInotifyFileWatcher(filename)
+	if t.FS == nil {
+		t.FS = vfs.OS
 	}
 
+	t.watcher = t.newWatcher()
+
 	if t.MustExist {
 		var err error
-		t.file, err = OpenFile(t.Filename)
+		if t.Pipe {
+			// Opening a pipe would block until it has a writer.
+			_, err = t.FS.Stat(t.Filename)
+		} else {
+			t.file, err = t.FS.Open(t.Filename)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -135,27 +226,95 @@ func TailFile(filename string, config Config) (*Tail, error) {
 	return t, nil
 }
 
-// Return the file's current position, like stdio's ftell().
-// But this value is not very accurate.
-// it may readed one line in the chan(tail.Lines),
-// so it may lost one line.
-func (tail *Tail) Tell() (offset int64, err error) {
-	if tail.file == nil {
-		return
+// TailReader begins tailing lines read from r, such as os.Stdin, a pipe
+// or a network connection, until r returns io.EOF or another error.
+// Lines are delivered as with TailFile, honouring MaxLineSize and
+// RateLimiter; the file specific settings of config are ignored.
+// If r is an io.Closer, it is closed once tailing stops, which also
+// lets Stop interrupt a blocked read.
+func TailReader(r io.Reader, config Config) (*Tail, error) {
+	t := &Tail{
+		Lines:    make(chan *Line),
+		Config:   config,
+		requests: make(chan *request),
 	}
-	offset, err = tail.file.Seek(0, os.SEEK_CUR)
-	if err != nil {
-		return
+	t.resetAcks(0)
+
+	if t.Logger == nil {
+		t.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	t.reader = t.newReader(r)
+	if c, ok := r.(io.Closer); ok {
+		go func() {
+			<-t.Dying()
+			if t.Err() == errStopAtEOF {
+				// Keep reading until EOF.
+				<-t.Dead()
+			}
+			c.Close()
+		}()
+	}
+
+	go t.tailReaderSync()
+
+	return t, nil
+}
+
+func (tail *Tail) newWatcher() watch.FileWatcher {
+	if tail.NewWatcher != nil {
+		return tail.NewWatcher(tail.Filename)
+	}
+	if fs, ok := tail.FS.(vfs.Notifier); ok {
+		return watch.NewNotifyingFileWatcher(fs, tail.Filename)
+	}
+	if tail.Poll || tail.FS != vfs.OS {
+		fw := watch.NewPollingFileWatcher(tail.Filename)
+		fw.Interval = tail.PollInterval
+		fw.MaxInterval = tail.MaxPollInterval
+		fw.FS = tail.FS
+		return fw
 	}
+	if tail.PollFallback {
+		fw := watch.NewHybridFileWatcher(tail.Filename)
+		fw.PollInterval = tail.PollInterval
+		fw.MaxPollInterval = tail.MaxPollInterval
+		return fw
+	}
+	return watch.NewInotifyFileWatcher(tail.Filename)
+}
 
+// Tell returns the position just past the last line sent to Lines,
+// like stdio's ftell(): tailing again from there resumes with the next
+// line. Right after a line is received, Tell may briefly return the
+// position of its start, but never a position past a line not yet
+// received: Line.End is exact. After the file is reopened, it is the
+// position in the new file.
+func (tail *Tail) Tell() (offset int64, err error) {
 	tail.lk.Lock()
 	defer tail.lk.Unlock()
-	if tail.reader == nil {
-		return
-	}
+	return tail.delivered, nil
+}
 
-	offset -= int64(tail.reader.Buffered())
-	return
+// setOffset records the position in a newly opened or seeked file.
+func (tail *Tail) setOffset(offset int64) {
+	tail.lk.Lock()
+	tail.offset = offset
+	tail.delivered = offset
+	tail.resetAcks(offset)
+	tail.lk.Unlock()
+}
+
+// WatchMode reports the mechanism currently used to detect changes to
+// the file. With PollFallback, this changes from inotify to polling
+// once inotify is found not to work for the file.
+func (tail *Tail) WatchMode() watch.Mode {
+	if m, ok := tail.watcher.(interface {
+		Mode() watch.Mode
+	}); ok {
+		return m.Mode()
+	}
+	return watch.ModeUnknown
 }
 
 // Stop stops the tailing activity.
@@ -172,6 +331,105 @@ func (tail *Tail) StopAtEOF() error {
 
 var errStopAtEOF = errors.New("tail: stop at eof")
 
+// ErrNotSeekable is returned by Seek on named pipes and readers.
+var ErrNotSeekable = errors.New("tail: cannot seek")
+
+// request is a call to Pause, Resume or Seek.
+type request struct {
+	pause, resume bool
+	seek          *SeekInfo
+	done          chan error
+}
+
+// Pause stops reading the file until Resume is called. The file stays
+// open and watched, so that changes made meanwhile, such as rotations,
+// are handled on Resume. A line read before Pause was called may
+// still be sent to Lines.
+func (tail *Tail) Pause() error {
+	return tail.request(&request{pause: true})
+}
+
+// Resume resumes reading after Pause.
+func (tail *Tail) Resume() error {
+	return tail.request(&request{resume: true})
+}
+
+// Seek moves to pos in the file, to tail it from there, eg: to replay
+// it. os.SEEK_CUR is relative to Tell. A line read from the previous
+// position but not yet received from Lines is dropped. Seeking does
+// not resume a paused tail.
+func (tail *Tail) Seek(pos SeekInfo) error {
+	return tail.request(&request{seek: &pos})
+}
+
+// request passes r to the goroutine reading the file, and waits for it
+// to be handled. It returns ErrStop once the tail is stopped.
+func (tail *Tail) request(r *request) error {
+	r.done = make(chan error, 1)
+	select {
+	case tail.requests <- r:
+	case <-tail.Dead():
+		return ErrStop
+	}
+	select {
+	case err := <-r.done:
+		return err
+	case <-tail.Dead():
+		return ErrStop
+	}
+}
+
+// handle handles a request, from the goroutine reading the file.
+func (tail *Tail) handle(r *request) {
+	var err error
+	switch {
+	case r.pause:
+		tail.paused = true
+	case r.resume:
+		tail.paused = false
+	case tail.file == nil || tail.Pipe:
+		err = ErrNotSeekable
+	default:
+		pos := *r.seek
+		if pos.Whence == os.SEEK_CUR {
+			offset, _ := tail.Tell()
+			pos = SeekInfo{Offset: offset + pos.Offset, Whence: os.SEEK_SET}
+		}
+		if err = tail.seekTo(pos); err == nil {
+			tail.lk.Lock()
+			tail.delivered = tail.offset
+			tail.resetAcks(tail.offset)
+			tail.lk.Unlock()
+			tail.seeked = true
+			tail.held = nil
+			tail.eventTime = time.Time{}
+		}
+	}
+	r.done <- err
+}
+
+// handleRequests handles pending requests, and waits while paused. It
+// returns false if the tail is stopped meanwhile.
+func (tail *Tail) handleRequests() bool {
+	for {
+		if tail.paused {
+			select {
+			case r := <-tail.requests:
+				tail.handle(r)
+			case <-tail.Dying():
+				return false
+			}
+			continue
+		}
+		select {
+		case r := <-tail.requests:
+			tail.handle(r)
+		default:
+			return true
+		}
+	}
+}
+
 func (tail *Tail) close() {
 	close(tail.Lines)
 	tail.closeFile()
@@ -185,10 +443,15 @@ func (tail *Tail) closeFile() {
 }
 
 func (tail *Tail) reopen() error {
+	// Runs of repeats do not span files, whose positions differ.
+	tail.flush()
 	tail.closeFile()
 	for {
 		var err error
-		tail.file, err = OpenFile(tail.Filename)
+		tail.file, err = tail.open()
+		if err == tomb.ErrDying {
+			return err
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
 				tail.Logger.Printf("Waiting for %s to appear...", tail.Filename)
@@ -204,12 +467,71 @@ func (tail *Tail) reopen() error {
 		}
 		break
 	}
+	tail.setOffset(0)
+	// Lines of the new file do not continue those before.
+	tail.eventTime = time.Time{}
+	return nil
+}
+
+// open opens the file. Named pipes are opened in a way that lets Stop
+// interrupt waiting for a writer, as well as reading from the pipe.
+func (tail *Tail) open() (vfs.File, error) {
+	if !tail.Pipe || tail.FS != vfs.OS {
+		return tail.FS.Open(tail.Filename)
+	}
+	f, err := vfs.OpenPipe(tail.Filename, tail.Dying())
+	if err == vfs.ErrPipeCancelled {
+		return nil, tomb.ErrDying
+	}
+	if err != nil {
+		return nil, err
+	}
+	pf := &pipeFile{File: f, closed: make(chan struct{})}
+	go func() {
+		select {
+		case <-tail.Dying():
+			if tail.Err() == errStopAtEOF {
+				// Keep reading until EOF.
+				<-tail.Dead()
+			}
+			pf.Close()
+		case <-pf.closed:
+		}
+	}()
+	return pf, nil
+}
+
+// pipeFile is a named pipe opened by Tail.open.
+type pipeFile struct {
+	*os.File
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (f *pipeFile) Close() error {
+	var err error
+	f.once.Do(func() {
+		close(f.closed)
+		err = f.File.Close()
+	})
+	return err
+}
+
+// reopenPipe waits for the next writer of the named pipe, once all
+// writers closed it.
+func (tail *Tail) reopenPipe() error {
+	tail.Logger.Printf("Waiting for a writer on %s ...", tail.Filename)
+	if err := tail.reopen(); err != nil {
+		return err
+	}
+	tail.openReader()
 	return nil
 }
 
 func (tail *Tail) readLine() (string, error) {
 	tail.lk.Lock()
 	line, err := tail.reader.ReadString('\n')
+	tail.offset += int64(len(line))
 	tail.lk.Unlock()
 	if err != nil {
 		// Note ReadString "returns the data read before the error" in
@@ -226,8 +548,9 @@ func (tail *Tail) readLine() (string, error) {
 func (tail *Tail) tailFileSync() {
 	defer tail.Done()
 	defer tail.close()
+	defer tail.flushAtEnd()
 
-	if !tail.MustExist {
+	if tail.file == nil {
 		// deferred first open.
 		err := tail.reopen()
 		if err != nil {
@@ -239,48 +562,60 @@ func (tail *Tail) tailFileSync() {
 	}
 
 	// Seek to requested location on first open of the file.
-	if tail.Location != nil {
-		_, err := tail.file.Seek(tail.Location.Offset, tail.Location.Whence)
+	if !tail.LocationTime.IsZero() && !tail.Pipe {
+		if tail.TimeParser == nil {
+			tail.Killf("LocationTime requires a TimeParser")
+			return
+		}
+		offset, err := seekTime(tail.file, tail.LocationTime, tail.TimeParser)
+		if err == nil {
+			_, err = tail.file.Seek(offset, os.SEEK_SET)
+		}
+		tail.Logger.Printf("Seeked %s - %s at %d\n", tail.Filename, tail.LocationTime, offset)
+		if err != nil {
+			tail.Killf("Seek error on %s: %s", tail.Filename, err)
+			return
+		}
+		tail.setOffset(offset)
+	} else if tail.Location != nil && !tail.Pipe {
+		offset, err := tail.file.Seek(tail.Location.Offset, tail.Location.Whence)
 		tail.Logger.Printf("Seeked %s - %+v\n", tail.Filename, tail.Location)
 		if err != nil {
 			tail.Killf("Seek error on %s: %s", tail.Filename, err)
 			return
 		}
+		tail.setOffset(offset)
 	}
 
 	tail.openReader()
 
-	var offset int64
-	var err error
-
 	// Read line by line.
 	for {
-		// do not seek in named pipes
-		if !tail.Pipe {
-			// grab the position in case we need to back up in the event of a half-line
-			offset, err = tail.Tell()
-			if err != nil {
-				tail.Kill(err)
-				return
-			}
+		if !tail.handleRequests() {
+			return
 		}
+		tail.seeked = false
+
+		// grab the position in case we need to back up in the event of a half-line
+		offset := tail.offset
 
 		line, err := tail.readLine()
 
 		// Process `line` even if err is EOF.
 		if err == nil {
-			cooloff := !tail.sendLine(line)
+			cooloff := !tail.sendLine(line, offset)
+			if tail.seeked {
+				continue
+			}
 			if cooloff {
 				// Wait a second before seeking till the end of
 				// file when rate limit is reached.
-				msg := ("Too much log activity; waiting a second " +
-					"before resuming tailing")
-				tail.Lines <- &Line{msg, time.Now(), errors.New(msg)}
-				select {
-				case <-time.After(time.Second):
-				case <-tail.Dying():
+				if !tail.cooloff() {
 					return
 				}
+				if tail.Pipe {
+					continue
+				}
 				if err := tail.seekEnd(); err != nil {
 					tail.Kill(err)
 					return
@@ -289,11 +624,30 @@ func (tail *Tail) tailFileSync() {
 		} else if err == io.EOF {
 			if !tail.Follow {
 				if line != "" {
-					tail.sendLine(line)
+					tail.sendLine(line, offset)
+				}
+				if tail.seeked {
+					continue
 				}
 				return
 			}
 
+			if tail.Pipe {
+				// All writers closed the pipe; deliver what they
+				// left and wait for the next one. Pipes cannot be
+				// seeked so partial lines are not held back.
+				if line != "" {
+					tail.sendLine(line, offset)
+				}
+				if err := tail.reopenPipe(); err != nil {
+					if err != tomb.ErrDying {
+						tail.Kill(err)
+					}
+					return
+				}
+				continue
+			}
+
 			if tail.Follow && line != "" {
 				// this has the potential to never return the last line if
 				// it's not followed by a newline; seems a fair trade here
@@ -316,7 +670,56 @@ func (tail *Tail) tailFileSync() {
 			}
 		} else {
 			// non-EOF error
-			tail.Killf("Error reading %s: %s", tail.Filename, err)
+			select {
+			case <-tail.Dying():
+				// The pipe was closed by Stop.
+			default:
+				tail.Killf("Error reading %s: %s", tail.Filename, err)
+			}
+			return
+		}
+
+		select {
+		case <-tail.Dying():
+			if tail.Err() == errStopAtEOF {
+				continue
+			}
+			return
+		default:
+		}
+	}
+}
+
+// tailReaderSync reads lines from tail.reader until EOF or an error.
+func (tail *Tail) tailReaderSync() {
+	defer tail.Done()
+	defer close(tail.Lines)
+	defer tail.flushAtEnd()
+
+	for {
+		if !tail.handleRequests() {
+			return
+		}
+		offset := tail.offset
+		line, err := tail.readLine()
+
+		if err == nil {
+			cooloff := !tail.sendLine(line, offset)
+			if cooloff && !tail.cooloff() {
+				return
+			}
+		} else if err == io.EOF {
+			if line != "" {
+				tail.sendLine(line, offset)
+			}
+			return
+		} else {
+			select {
+			case <-tail.Dying():
+				// The reader was closed by Stop.
+			default:
+				tail.Killf("Error reading: %s", err)
+			}
 			return
 		}
 
@@ -331,6 +734,21 @@ func (tail *Tail) tailFileSync() {
 	}
 }
 
+// cooloff notifies the rate limit was reached and waits for a second.
+// It returns false if the tail is stopped meanwhile.
+func (tail *Tail) cooloff() bool {
+	msg := ("Too much log activity; waiting a second " +
+		"before resuming tailing")
+	tail.flush()
+	tail.Lines <- &Line{Text: msg, Time: time.Now(), Err: errors.New(msg)}
+	select {
+	case <-time.After(time.Second):
+		return true
+	case <-tail.Dying():
+		return false
+	}
+}
+
 // waitForChanges waits until the file has been appended, deleted,
 // moved or truncated. When moved or deleted - the file will be
 // reopened if ReOpen is true. Truncated files are always reopened.
@@ -347,8 +765,14 @@ func (tail *Tail) waitForChanges() error {
 	}
 
 	select {
+	case r := <-tail.requests:
+		tail.handle(r)
+		return nil
 	case <-tail.changes.Modified:
 		return nil
+	case <-tail.flushTimeout():
+		tail.flush()
+		return nil
 	case <-tail.changes.Deleted:
 		tail.changes = nil
 		if tail.ReOpen {
@@ -380,12 +804,15 @@ func (tail *Tail) waitForChanges() error {
 }
 
 func (tail *Tail) openReader() {
+	tail.reader = tail.newReader(tail.file)
+}
+
+func (tail *Tail) newReader(r io.Reader) *bufio.Reader {
 	if tail.MaxLineSize > 0 {
 		// add 2 to account for newline characters
-		tail.reader = bufio.NewReaderSize(tail.file, tail.MaxLineSize+2)
-	} else {
-		tail.reader = bufio.NewReader(tail.file)
+		return bufio.NewReaderSize(r, tail.MaxLineSize+2)
 	}
+	return bufio.NewReader(r)
 }
 
 func (tail *Tail) seekEnd() error {
@@ -393,32 +820,78 @@ func (tail *Tail) seekEnd() error {
 }
 
 func (tail *Tail) seekTo(pos SeekInfo) error {
-	_, err := tail.file.Seek(pos.Offset, pos.Whence)
+	offset, err := tail.file.Seek(pos.Offset, pos.Whence)
 	if err != nil {
 		return fmt.Errorf("Seek error on %s: %s", tail.Filename, err)
 	}
 	// Reset the read buffer whenever the file is re-seek'ed
 	tail.reader.Reset(tail.file)
+	tail.lk.Lock()
+	tail.offset = offset
+	tail.lk.Unlock()
 	return nil
 }
 
 // sendLine sends the line(s) to Lines channel, splitting longer lines
-// if necessary. Return false if rate limit is reached.
-func (tail *Tail) sendLine(line string) bool {
+// if necessary. offset is the position of line in the file, which was
+// just read. Return false if rate limit is reached.
+func (tail *Tail) sendLine(line string, offset int64) bool {
 	now := time.Now()
-	lines := []string{line}
 
-	// Split longer lines
-	if tail.MaxLineSize > 0 && len(line) > tail.MaxLineSize {
-		lines = util.PartitionString(line, tail.MaxLineSize)
+	if tail.TimeParser != nil {
+		if t, ok := tail.TimeParser(line); ok {
+			tail.eventTime = t
+		}
 	}
 
-	for _, line := range lines {
-		tail.Lines <- &Line{line, now, nil}
+	// Processors see whole lines, before longer ones are split.
+	lines := []*Line{{Text: line, Time: now, Offset: offset, EventTime: tail.eventTime}}
+	if len(tail.Processors) > 0 {
+		var err error
+		if lines, err = tail.process(lines[0]); err != nil {
+			tail.Kill(err)
+			return true
+		}
+		if len(lines) == 0 {
+			tail.skip(tail.offset)
+		}
+	}
+
+	sent := 0
+	for _, l := range lines {
+		parts := []string{l.Text}
+
+		// Split longer lines
+		if tail.MaxLineSize > 0 && len(l.Text) > tail.MaxLineSize {
+			parts = util.PartitionString(l.Text, tail.MaxLineSize)
+		}
+
+		offset := l.Offset
+		for i, part := range parts {
+			end := offset + int64(len(part))
+			if i == len(parts)-1 || len(tail.Processors) > 0 {
+				// Past the newline, if any. The text of processed
+				// lines may differ from the file: they all end there.
+				end = tail.offset
+			}
+			out := l
+			if len(parts) > 1 {
+				p := *l
+				p.Text, p.Offset = part, offset
+				out = &p
+			}
+			if !tail.emit(out, end) {
+				return true
+			}
+			sent++
+			if len(tail.Processors) == 0 {
+				offset = end
+			}
+		}
 	}
 
 	if tail.Config.RateLimiter != nil {
-		ok := tail.Config.RateLimiter.Pour(uint16(len(lines)))
+		ok := tail.Config.RateLimiter.Pour(uint16(sent))
 		if !ok {
 			tail.Logger.Printf("Leaky bucket full (%v); entering 1s cooloff period.\n",
 				tail.Filename)
@@ -429,9 +902,77 @@ func (tail *Tail) sendLine(line string) bool {
 	return true
 }
 
+// deliver sends line, ending at end, to Lines, and moves Tell past it.
+func (tail *Tail) deliver(line *Line, end int64) bool {
+	line.End = end
+	if tail.acks != nil {
+		line.ack = tail.acks.add(end)
+	}
+	if !tail.send(line) {
+		return false
+	}
+	tail.lk.Lock()
+	tail.delivered = end
+	tail.lk.Unlock()
+	return true
+}
+
+// skip moves Tell, and Checkpoint with Ack, past a line dropped by the
+// processors, unless a line before it is held back.
+func (tail *Tail) skip(end int64) {
+	if tail.held != nil {
+		return
+	}
+	if tail.acks != nil {
+		tail.acks.add(end).ack()
+	}
+	tail.lk.Lock()
+	tail.delivered = end
+	tail.lk.Unlock()
+}
+
+// send sends a line to Lines, handling requests meanwhile. It returns
+// false if the line was dropped by Seek or Stop.
+func (tail *Tail) send(line *Line) bool {
+	for {
+		dying := tail.Dying()
+		if tail.Err() == errStopAtEOF {
+			// Lines up to the end are still sent.
+			dying = nil
+		}
+		select {
+		case tail.Lines <- line:
+			return true
+		case <-dying:
+			if tail.Err() == errStopAtEOF {
+				continue
+			}
+			return false
+		case r := <-tail.requests:
+			tail.handle(r)
+			if tail.paused && !tail.handleRequests() {
+				return false // Stopped while paused
+			}
+			if tail.seeked {
+				return false
+			}
+		}
+	}
+}
+
+// OpenFile opens the named file for reading, allowing it to be renamed
+// or deleted while open on Windows.
+func OpenFile(name string) (file *os.File, err error) {
+	return vfs.OpenFile(name)
+}
+
 // Cleanup removes inotify watches added by the tail package. This function is
 // meant to be invoked from a process's exit handler. Linux kernel may not
 // automatically remove inotify watches after the process exits.
 func (tail *Tail) Cleanup() {
+	if tail.watcher == nil {
+		// Tailing a reader.
+		return
+	}
 	watch.Cleanup(tail.Filename)
 }
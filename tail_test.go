@@ -7,15 +7,22 @@
 package tail
 
 import (
+	"errors"
 	_ "fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hpcloud/tail/ratelimiter"
+	"github.com/hpcloud/tail/vfs"
 	"github.com/hpcloud/tail/watch"
+	"gopkg.in/tomb.v1"
 )
 
 func init() {
@@ -112,6 +119,16 @@ func TestStopAtEOF(t *testing.T) {
 	tailTest.Cleanup(tail, true)
 }
 
+func TestStopAtEOFSendsRemainingLines(t *testing.T) {
+	tailTest := NewTailTest("stop-at-eof-remaining", t)
+	tailTest.CreateFile("test.txt", "hello\nthere\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Location: nil})
+	<-tail.Lines
+	go tail.StopAtEOF()
+	tailTest.VerifyTailOutput(tail, []string{"there", "world"}, true)
+	tail.Cleanup()
+}
+
 func TestMaxLineSizeFollow(t *testing.T) {
 	// As last file line does not end with newline, it will not be present in tail's output
 	maxLineSize(t, true, "hello\nworld\nfin\nhe", []string{"hel", "lo", "wor", "ld", "fin"})
@@ -219,6 +236,96 @@ func TestReOpenPolling(t *testing.T) {
 	reOpen(t, true)
 }
 
+func TestPollFallbackStartsWithInotify(t *testing.T) {
+	tailTest := NewTailTest("poll-fallback", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, PollFallback: true})
+	go tailTest.VerifyTailOutput(tail, []string{"hello", "world", "more", "data"}, false)
+
+	<-time.After(100 * time.Millisecond)
+	tailTest.AppendFile("test.txt", "more\ndata\n")
+	<-time.After(100 * time.Millisecond)
+	if mode := tail.WatchMode(); mode != watch.ModeInotify {
+		t.Errorf("expected inotify mode, got %s", mode)
+	}
+	tailTest.RemoveFile("test.txt")
+	tailTest.Cleanup(tail, true)
+}
+
+// statCountingFS is the filesystem of the OS, counting calls to Stat.
+type statCountingFS struct {
+	vfs.FS
+	mux   sync.Mutex
+	stats int
+}
+
+func (fs *statCountingFS) Stat(name string) (os.FileInfo, error) {
+	fs.mux.Lock()
+	fs.stats++
+	fs.mux.Unlock()
+	return fs.FS.Stat(name)
+}
+
+// count returns the number of stats since the previous call.
+func (fs *statCountingFS) count() int {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	n := fs.stats
+	fs.stats = 0
+	return n
+}
+
+func TestAdaptivePolling(t *testing.T) {
+	tailTest := NewTailTest("adaptive-polling", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	fs := &statCountingFS{FS: vfs.OS}
+	tail := tailTest.StartTail("test.txt", Config{
+		Follow:          true,
+		FS:              fs,
+		PollInterval:    2 * time.Millisecond,
+		MaxPollInterval: 40 * time.Millisecond})
+	tailTest.ReadLines(tail, []string{"hello"})
+
+	// Once backed off, the file is polled every 40ms, rather than 2ms.
+	<-time.After(300 * time.Millisecond)
+	fs.count()
+	<-time.After(200 * time.Millisecond)
+	if n := fs.count(); n < 3 || n > 8 {
+		t.Errorf("expected about 5 polls in 200ms once backed off, got %d", n)
+	}
+
+	// A change resets the interval to 2ms, doubling from there.
+	tailTest.AppendFile("test.txt", "world\n")
+	tailTest.ReadLines(tail, []string{"world"})
+	fs.count()
+	<-time.After(40 * time.Millisecond)
+	if n := fs.count(); n < 3 {
+		t.Errorf("expected at least 3 polls in 40ms after a change, got %d", n)
+	}
+
+	tailTest.RemoveFile("test.txt")
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestPollingSameFileTwice(t *testing.T) {
+	tailTest := NewTailTest("polling-same-file", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	config := Config{Follow: true, Poll: true}
+	tail1 := tailTest.StartTail("test.txt", config)
+	tail2 := tailTest.StartTail("test.txt", config)
+
+	<-time.After(100 * time.Millisecond)
+	tailTest.AppendFile("test.txt", "world\n")
+	tailTest.ReadLines(tail1, []string{"hello", "world"})
+	tailTest.ReadLines(tail2, []string{"hello", "world"})
+
+	tailTest.RemoveFile("test.txt")
+	tail1.Stop()
+	tail2.Stop()
+	tail1.Cleanup()
+}
+
 // The use of polling file watcher could affect file rotation
 // (detected via renames), so test these explicitly.
 
@@ -265,13 +372,16 @@ func TestTell(t *testing.T) {
 		Follow:   false,
 		Location: &SeekInfo{0, os.SEEK_SET}}
 	tail := tailTest.StartTail("test.txt", config)
-	// read noe line
+	// read one line
 	<-tail.Lines
 	offset, err := tail.Tell()
 	if err != nil {
 		tailTest.Errorf("Tell return error: %s", err.Error())
 	}
-	tail.Done()
+	if offset != 6 {
+		tailTest.Errorf("expected Tell to return 6, got %d", offset)
+	}
+	tail.Stop()
 	// tail.close()
 
 	config = Config{
@@ -279,17 +389,388 @@ func TestTell(t *testing.T) {
 		Location: &SeekInfo{offset, os.SEEK_SET}}
 	tail = tailTest.StartTail("test.txt", config)
 	for l := range tail.Lines {
-		// it may readed one line in the chan(tail.Lines),
-		// so it may lost one line.
-		if l.Text != "world" && l.Text != "again" {
-			tailTest.Fatalf("mismatch; expected world or again, but got %s",
-				l.Text)
+		if l.Text != "world" {
+			tailTest.Fatalf("mismatch; expected world, but got %s", l.Text)
 		}
 		break
 	}
 	tailTest.RemoveFile("test.txt")
-	tail.Done()
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestTellFollow(t *testing.T) {
+	tailTest := NewTailTest("tell-follow", t)
+	tailTest.CreateFile("test.txt", "hello\nwor")
+	tail := tailTest.StartTail("test.txt", Config{
+		Follow:      true,
+		Location:    &SeekInfo{0, os.SEEK_SET},
+		MaxLineSize: 3})
+	for _, expected := range []struct {
+		text string
+		end  int64
+	}{{"hel", 3}, {"lo", 6}, {"wor", 9}, {"ld", 12}} {
+		if expected.text == "wor" {
+			// Complete the partial line.
+			tailTest.AppendFile("test.txt", "ld\n")
+		}
+		line := <-tail.Lines
+		if line.Text != expected.text || line.End != expected.end {
+			t.Errorf("expected %q ending at %d, got %q ending at %d",
+				expected.text, expected.end, line.Text, line.End)
+		}
+	}
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestPauseResume(t *testing.T) {
+	tailTest := NewTailTest("pause-resume", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Location: nil})
+	if line := <-tail.Lines; line.Text != "hello" {
+		t.Fatalf("expected hello, got %q", line.Text)
+	}
+	if err := tail.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	tailTest.AppendFile("test.txt", "world\n")
+	select {
+	case line := <-tail.Lines:
+		t.Fatalf("expected no line while paused, got %q", line.Text)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := tail.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-tail.Lines; line.Text != "world" {
+		t.Fatalf("expected world, got %q", line.Text)
+	}
+	tail.Stop()
+	if err := tail.Pause(); err != ErrStop {
+		t.Errorf("expected ErrStop once stopped, got %v", err)
+	}
+	tail.Cleanup()
+}
+
+func TestSeekWhileRunning(t *testing.T) {
+	tailTest := NewTailTest("seek-while-running", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Location: nil})
+
+	// "hello" is dropped while waiting to be received.
+	if err := tail.Seek(SeekInfo{6, os.SEEK_SET}); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-tail.Lines; line.Text != "world" || line.Offset != 6 {
+		t.Fatalf("expected world at 6, got %q at %d", line.Text, line.Offset)
+	}
+
+	// Replay the file once at its end.
+	time.Sleep(50 * time.Millisecond)
+	if err := tail.Seek(SeekInfo{-12, os.SEEK_CUR}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"hello", "world"} {
+		if line := <-tail.Lines; line.Text != expected {
+			t.Fatalf("expected %q, got %q", expected, line.Text)
+		}
+	}
+
+	// Seeking while paused does not resume.
+	tail.Pause()
+	tail.Seek(SeekInfo{0, os.SEEK_SET})
+	select {
+	case line := <-tail.Lines:
+		t.Fatalf("expected no line while paused, got %q", line.Text)
+	case <-time.After(50 * time.Millisecond):
+	}
+	tail.Resume()
+	if line := <-tail.Lines; line.Text != "hello" {
+		t.Fatalf("expected hello, got %q", line.Text)
+	}
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestSeekReader(t *testing.T) {
+	tail, err := TailReader(strings.NewReader("hello\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tail.Seek(SeekInfo{0, os.SEEK_SET}); err != ErrNotSeekable {
+		t.Errorf("expected ErrNotSeekable, got %v", err)
+	}
+	<-tail.Lines
+	tail.Wait()
+}
+
+func TestLocationTime(t *testing.T) {
+	tailTest := NewTailTest("location-time", t)
+	tailTest.CreateFile("test.txt", "14:03 a\n14:04 b\n14:06 c\n  more\n14:07 d\n")
+	tail := tailTest.StartTail("test.txt", Config{
+		LocationTime: time.Date(0, 1, 1, 14, 5, 0, 0, time.UTC),
+		TimeParser:   LayoutTimeParser("15:04"),
+	})
+	go tailTest.VerifyTailOutput(tail, []string{"14:06 c", "  more", "14:07 d"}, true)
+	tailTest.Cleanup(tail, false)
+}
+
+func TestEventTime(t *testing.T) {
+	tailTest := NewTailTest("event-time", t)
+	tailTest.CreateFile("test.txt", "2015-03-04 05:06:07 error\n  at main\n2015-03-04 05:06:08 done\n")
+	tail := tailTest.StartTail("test.txt", Config{
+		TimeParser: (&TimeExtractor{Layouts: []string{"2006-01-02 15:04:05"}}).Parse,
+	})
+	for _, expected := range []int{7, 7, 8} {
+		line := <-tail.Lines
+		if line.EventTime.Second() != expected || line.Time.Year() < 2016 {
+			t.Errorf("%q: expected event time at second %d, and read time now, got %s and %s",
+				line.Text, expected, line.EventTime, line.Time)
+		}
+	}
+	tail.Wait()
+	tail.Cleanup()
+}
+
+func TestEventTimeAfterSeek(t *testing.T) {
+	tailTest := NewTailTest("event-time-seek", t)
+	tailTest.CreateFile("test.txt", "2015-03-04 05:06:07 error\n  at main\n")
+	tail := tailTest.StartTail("test.txt", Config{
+		Follow:     true,
+		TimeParser: (&TimeExtractor{Layouts: []string{"2006-01-02 15:04:05"}}).Parse,
+	})
+	<-tail.Lines
+	cont := <-tail.Lines
+	if cont.EventTime.IsZero() {
+		t.Errorf("expected %q to have the event time of the line before it", cont.Text)
+	}
+
+	// Read again from there, it no longer follows that line.
+	if err := tail.Seek(SeekInfo{Offset: cont.Offset, Whence: os.SEEK_SET}); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-tail.Lines; line.Text != cont.Text || !line.EventTime.IsZero() {
+		t.Errorf("expected %q without event time after seeking, got %+v", cont.Text, line)
+	}
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestDedup(t *testing.T) {
+	tailTest := NewTailTest("dedup", t)
+	tailTest.CreateFile("test.txt", "a\na\na\nb\nretry 1\nretry 2\n")
+	tail := tailTest.StartTail("test.txt", Config{Dedup: &Dedup{
+		Normalize: func(line string) string { return strings.TrimRight(line, "0123456789") },
+	}})
+	for _, expected := range []struct {
+		text    string
+		repeats int
+	}{{"a", 2}, {"b", 0}, {"retry 1", 1}} {
+		line := <-tail.Lines
+		if line.Text != expected.text || line.Repeats != expected.repeats ||
+			(line.Repeats > 0) == line.LastTime.IsZero() {
+			t.Errorf("expected %q repeated %d times, got %+v", expected.text, expected.repeats, line)
+		}
+	}
+	if line, ok := <-tail.Lines; ok {
+		t.Errorf("expected no more lines, got %+v", line)
+	}
+	tail.Wait()
+	tail.Cleanup()
+}
+
+func TestDedupWindow(t *testing.T) {
+	tailTest := NewTailTest("dedup-window", t)
+	tailTest.CreateFile("test.txt", "crash\ncrash\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Dedup: &Dedup{MaxWindow: 100 * time.Millisecond}})
+
+	// The run is sent once its window elapses, although it may go on.
+	select {
+	case line := <-tail.Lines:
+		if line.Text != "crash" || line.Repeats != 1 || line.End != 12 {
+			t.Errorf("expected crash repeated once, ending at 12, got %+v", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the held line")
+	}
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestAck(t *testing.T) {
+	tailTest := NewTailTest("ack", t)
+	tailTest.CreateFile("test.txt", "one\ntwo\nthree\n")
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Ack: true})
+	lines := make([]*Line, 3)
+	for i := range lines {
+		lines[i] = <-tail.Lines
+	}
+
+	// The checkpoint only advances past contiguous acknowledged lines.
+	for _, step := range []struct {
+		ack        int
+		checkpoint int64
+	}{{1, 0}, {0, 8}, {0, 8}, {2, 14}} {
+		lines[step.ack].Ack()
+		if checkpoint := tail.Checkpoint(); checkpoint != step.checkpoint {
+			t.Errorf("expected checkpoint %d after acknowledging %q, got %d",
+				step.checkpoint, lines[step.ack].Text, checkpoint)
+		}
+	}
+
+	// Lines read again after a Seek are acknowledged anew.
+	if err := tail.Seek(SeekInfo{Offset: 4, Whence: os.SEEK_SET}); err != nil {
+		t.Fatal(err)
+	}
+	line := <-tail.Lines
+	if checkpoint := tail.Checkpoint(); line.Text != "two" || checkpoint != 4 {
+		t.Errorf("expected two and checkpoint 4 after seeking, got %q and %d", line.Text, checkpoint)
+	}
+	line.Ack()
+	if checkpoint := tail.Checkpoint(); checkpoint != 8 {
+		t.Errorf("expected checkpoint 8, got %d", checkpoint)
+	}
+	tail.Stop()
+	tail.Cleanup()
+}
+
+func TestProcessors(t *testing.T) {
+	tailTest := NewTailTest("processors", t)
+	tailTest.CreateFile("test.txt", "user=bob a,b\ndebug x\nuser=ann c\nbad\ndebug y\n")
+	split := &Processor{
+		Name: "split",
+		Process: func(line *Line) ([]*Line, error) {
+			if line.Text == "bad" {
+				return nil, errors.New("bad line")
+			}
+			var lines []*Line
+			for _, text := range strings.Split(line.Text, ",") {
+				l := *line
+				l.Text = text
+				lines = append(lines, &l)
+			}
+			return lines, nil
+		},
+		OnError: DropOnError,
+	}
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Processors: []*Processor{
+		Drop(regexp.MustCompile(`^debug`)),
+		Replace(regexp.MustCompile(`user=\w+`), "user=***"),
+		AddFields(map[string]string{"host": "web1", "env": "prod"}),
+		DropFields("env"),
+		split,
+	}})
+	for _, expected := range []string{"user=*** a", "b", "user=*** c"} {
+		line := <-tail.Lines
+		if line.Text != expected || len(line.Fields) != 1 || line.Fields["host"] != "web1" {
+			t.Errorf("expected %q with the host field, got %+v", expected, line)
+		}
+	}
+
+	// Tell moves past the lines dropped at the end.
+	tail.StopAtEOF()
+	if offset, _ := tail.Tell(); offset != 44 {
+		t.Errorf("expected Tell past the dropped lines, got %d", offset)
+	}
+	if stats := split.Stats(); stats != (ProcessorStats{In: 3, Out: 3, Dropped: 1, Errors: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	tail.Stop()
 	tail.Cleanup()
+
+	// StopOnError stops the tail.
+	split = &Processor{Name: "split", Process: split.Process, OnError: StopOnError}
+	tail, err := TailReader(strings.NewReader("a\nbad\nb\n"), Config{Processors: []*Processor{split}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := <-tail.Lines; line.Text != "a" {
+		t.Errorf("expected a, got %q", line.Text)
+	}
+	if line, ok := <-tail.Lines; ok {
+		t.Errorf("expected the tail to stop, got %q", line.Text)
+	}
+	if err := tail.Wait(); err == nil || err.Error() != "processor split: bad line" {
+		t.Errorf("expected the error of the processor, got %v", err)
+	}
+}
+
+func TestProcessorsBeforeSplit(t *testing.T) {
+	var seen []string
+	upper := &Processor{Name: "upper", Process: func(line *Line) ([]*Line, error) {
+		seen = append(seen, line.Text)
+		line.Text = strings.ToUpper(line.Text)
+		return []*Line{line}, nil
+	}}
+	tail, err := TailReader(strings.NewReader("abcdefgh\n"), Config{MaxLineSize: 4, Processors: []*Processor{upper}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for line := range tail.Lines {
+		lines = append(lines, line.Text)
+	}
+	if strings.Join(seen, ",") != "abcdefgh" || strings.Join(lines, ",") != "ABCD,EFGH" {
+		t.Errorf("expected the whole line processed, then split, got %q and %q", seen, lines)
+	}
+}
+
+func TestLineOffset(t *testing.T) {
+	tailTest := NewTailTest("line-offset", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\nfin\n")
+	tail := tailTest.StartTail("test.txt", Config{
+		Follow:      false,
+		Location:    &SeekInfo{6, os.SEEK_SET},
+		MaxLineSize: 3})
+	for _, expected := range []struct {
+		text   string
+		offset int64
+	}{{"wor", 6}, {"ld", 9}, {"fin", 12}} {
+		line := <-tail.Lines
+		if line.Text != expected.text || line.Offset != expected.offset {
+			t.Errorf("expected %q at %d, got %q at %d",
+				expected.text, expected.offset, line.Text, line.Offset)
+		}
+	}
+	tail.Wait()
+	tail.Cleanup()
+}
+
+// benchmarkTailFile measures reading a file of b.N lines.
+func benchmarkTailFile(b *testing.B, config Config) {
+	dir, err := ioutil.TempDir("", "tail-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	line := strings.Repeat("x", 99) + "\n"
+	filename := filepath.Join(dir, "test.txt")
+	if err := ioutil.WriteFile(filename, []byte(strings.Repeat(line, b.N)), 0600); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+
+	config.Logger = DiscardingLogger
+	tail, err := TailFile(filename, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _ = range tail.Lines {
+	}
+	if err := tail.Wait(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkTailFile(b *testing.B) {
+	benchmarkTailFile(b, Config{})
+}
+
+func BenchmarkTailFileMaxLineSize(b *testing.B) {
+	benchmarkTailFile(b, Config{MaxLineSize: 40})
 }
 
 func TestBlockUntilExists(t *testing.T) {
@@ -314,6 +795,149 @@ func TestBlockUntilExists(t *testing.T) {
 	tail.Cleanup()
 }
 
+func TestCustomWatcher(t *testing.T) {
+	tailTest := NewTailTest("custom-watcher", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	fw := &fakeWatcher{changes: watch.NewFileChanges()}
+	tail := tailTest.StartTail("test.txt", Config{
+		Follow: true,
+		NewWatcher: func(filename string) watch.FileWatcher {
+			fw.filename = filename
+			return fw
+		}})
+	tailTest.ReadLines(tail, []string{"hello"})
+	if fw.filename != tailTest.path+"/test.txt" {
+		t.Errorf("watcher created for %q", fw.filename)
+	}
+
+	// Appended data is only read once the watcher says so.
+	tailTest.AppendFile("test.txt", "world\n")
+	select {
+	case line := <-tail.Lines:
+		t.Fatalf("line read without notification: %+v", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fw.changes.NotifyModified()
+	tailTest.ReadLines(tail, []string{"world"})
+
+	fw.changes.NotifyDeleted()
+	if _, ok := <-tail.Lines; ok {
+		t.Error("tail should have stopped after deletion")
+	}
+	tail.Stop()
+}
+
+// fakeWatcher is a watch.FileWatcher driven by the test.
+type fakeWatcher struct {
+	filename string
+	changes  *watch.FileChanges
+}
+
+func (fw *fakeWatcher) BlockUntilExists(*tomb.Tomb) error {
+	return nil
+}
+
+func (fw *fakeWatcher) ChangeEvents(*tomb.Tomb, int64) (*watch.FileChanges, error) {
+	return fw.changes, nil
+}
+
+func TestMemFSRotation(t *testing.T) {
+	tailTest := NewTailTest("memfs-rotation", t)
+	fs := vfs.NewMemFS()
+	fs.WriteFile("test.txt", "hello\n")
+	tail, err := TailFile("test.txt", Config{Follow: true, ReOpen: true, FS: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailTest.ReadLines(tail, []string{"hello"})
+
+	fs.Append("test.txt", "world\n")
+	tailTest.ReadLines(tail, []string{"world"})
+
+	fs.Rename("test.txt", "test.txt.rotated")
+	fs.WriteFile("test.txt", "rotated\n")
+	tailTest.ReadLines(tail, []string{"rotated"})
+
+	fs.Truncate("test.txt", 0)
+	fs.Append("test.txt", "short\n")
+	tailTest.ReadLines(tail, []string{"short"})
+
+	fs.Remove("test.txt")
+	fs.WriteFile("test.txt", "recreated\n")
+	tailTest.ReadLines(tail, []string{"recreated"})
+	tail.Stop()
+}
+
+func TestMemFSTruncateGrowing(t *testing.T) {
+	tailTest := NewTailTest("memfs-truncate-growing", t)
+	fs := vfs.NewMemFS()
+	fs.WriteFile("test.txt", "hello\n")
+	tail, err := TailFile("test.txt", Config{Follow: true, ReOpen: true, FS: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailTest.ReadLines(tail, []string{"hello"})
+
+	// Not a truncation: hello is not read again.
+	fs.Truncate("test.txt", 8)
+	fs.Append("test.txt", "\nworld\n")
+	tailTest.ReadLines(tail, []string{"\x00\x00", "world"})
+	tail.Stop()
+}
+
+func TestMemFSDeleteStops(t *testing.T) {
+	tailTest := NewTailTest("memfs-delete", t)
+	fs := vfs.NewMemFS()
+	fs.WriteFile("test.txt", "hello\n")
+	tail, err := TailFile("test.txt", Config{Follow: true, FS: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailTest.ReadLines(tail, []string{"hello"})
+	fs.Remove("test.txt")
+	if line, ok := <-tail.Lines; ok {
+		t.Fatalf("more content from tail: %+v", line)
+	}
+	if err := tail.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTailReader(t *testing.T) {
+	tailTest := NewTailTest("tail-reader", t)
+	r := strings.NewReader("hello\nworld\nfin\nhe")
+	tail, err := TailReader(r, Config{MaxLineSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailTest.ReadLines(tail, []string{"hel", "lo", "wor", "ld", "fin", "he"})
+	if line, ok := <-tail.Lines; ok {
+		t.Fatalf("more content from tail: %+v", line)
+	}
+	if err := tail.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTailReaderStop(t *testing.T) {
+	tailTest := NewTailTest("tail-reader-stop", t)
+	r, w := io.Pipe()
+	tail, err := TailReader(r, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go io.WriteString(w, "hello\nworld\n")
+	tailTest.ReadLines(tail, []string{"hello", "world"})
+
+	// Stop must not hang on the pending read.
+	if err := tail.Stop(); err != nil {
+		t.Error(err)
+	}
+	if _, err := w.Write([]byte("more\n")); err != io.ErrClosedPipe {
+		t.Errorf("expected the reader to be closed, got %v", err)
+	}
+}
+
 func maxLineSize(t *testing.T, follow bool, fileContent string, expected []string) {
 	tailTest := NewTailTest("maxlinesize", t)
 	tailTest.CreateFile("test.txt", fileContent)
@@ -0,0 +1,149 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeParser returns the time of a line, and false if the line has
+// none, such as the continuation of a multi-line message.
+type TimeParser func(line string) (time.Time, bool)
+
+// LayoutTimeParser returns a TimeParser reading a time formatted with
+// layout, as understood by time.Parse, at the start of lines. Times
+// without a time zone are in UTC, and fields missing from layout are
+// zero, such as the year with time.Stamp.
+func LayoutTimeParser(layout string) TimeParser {
+	return func(line string) (time.Time, bool) {
+		return parsePrefix(line, layout, time.UTC)
+	}
+}
+
+// Epoch is the unit of times written as a number since the Unix
+// epoch.
+type Epoch int
+
+const (
+	NoEpoch      Epoch = iota // Times are formatted with layouts
+	EpochSeconds              // Possibly with a fractional part
+	EpochMillis
+)
+
+// TimeExtractor reads the time of lines, for Config.TimeParser:
+//
+//	config.TimeParser = (&tail.TimeExtractor{
+//		Regexp:  regexp.MustCompile(`time="([^"]+)"`),
+//		Layouts: []string{time.RFC3339Nano},
+//	}).Parse
+type TimeExtractor struct {
+	// Layouts, as understood by time.Parse, are tried in turn to parse
+	// times, unless Epoch is set.
+	Layouts []string
+	Epoch   Epoch
+
+	// Regexp, when set, finds the time in lines: it is its first
+	// capture group, or the whole match without groups. Otherwise
+	// times are at the start of lines.
+	Regexp *regexp.Regexp
+
+	// Location is the time zone of times formatted without one; UTC
+	// when nil.
+	Location *time.Location
+
+	// Now, when set, returns the current time, used to give times
+	// without a year (eg: time.Stamp) the current year, or the previous
+	// one for times that would be more than a day in the future.
+	Now func() time.Time
+}
+
+// Parse returns the time of line.
+func (e *TimeExtractor) Parse(line string) (time.Time, bool) {
+	if e.Regexp != nil {
+		m := e.Regexp.FindStringSubmatch(line)
+		switch {
+		case m == nil:
+			return time.Time{}, false
+		case len(m) > 1:
+			line = m[1]
+		default:
+			line = m[0]
+		}
+	}
+	if e.Epoch != NoEpoch {
+		return parseEpoch(line, e.Epoch)
+	}
+
+	loc := e.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range e.Layouts {
+		if t, ok := parsePrefix(line, layout, loc); ok {
+			if t.Year() == 0 {
+				t = e.withYear(t)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// withYear gives a time parsed without year the current year.
+func (e *TimeExtractor) withYear(t time.Time) time.Time {
+	now := time.Now()
+	if e.Now != nil {
+		now = e.Now()
+	}
+	now = now.In(t.Location())
+	withYear := t.AddDate(now.Year(), 0, 0)
+	if withYear.Sub(now) > 24*time.Hour {
+		// Eg: a line of December 31st read on January 1st.
+		withYear = t.AddDate(now.Year()-1, 0, 0)
+	}
+	return withYear
+}
+
+// epochPrefix matches a number since the Unix epoch, and its
+// fractional part.
+var epochPrefix = regexp.MustCompile(`^(\d{1,15})(?:\.(\d+))?`)
+
+func parseEpoch(s string, unit Epoch) (time.Time, bool) {
+	m := epochPrefix.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+	// The fraction, in nanoseconds for seconds, or in units of 1e-6
+	// for milliseconds.
+	digits := 9
+	if unit == EpochMillis {
+		digits = 6
+	}
+	frac := m[2] + strings.Repeat("0", digits)
+	f, _ := strconv.ParseInt(frac[:digits], 10, 64)
+	if unit == EpochMillis {
+		return time.Unix(0, n*1e6+f).UTC(), true
+	}
+	return time.Unix(n, f).UTC(), true
+}
+
+// parsePrefix parses the time at the start of line, followed by any
+// text.
+func parsePrefix(line, layout string, loc *time.Location) (time.Time, bool) {
+	t, err := time.ParseInLocation(layout, line, loc)
+	if err == nil {
+		return t, true
+	}
+	// A complete time followed by text fails with an "extra text"
+	// error, giving the text; parse what is before it.
+	perr, ok := err.(*time.ParseError)
+	if !ok || perr.LayoutElem != "" || perr.ValueElem == "" || !strings.HasSuffix(line, perr.ValueElem) {
+		return time.Time{}, false
+	}
+	t, err = time.ParseInLocation(layout, line[:len(line)-len(perr.ValueElem)], loc)
+	return t, err == nil
+}
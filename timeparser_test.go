@@ -0,0 +1,71 @@
+package tail
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLayoutTimeParser(t *testing.T) {
+	parse := LayoutTimeParser(time.RFC3339Nano)
+	for line, expected := range map[string]string{
+		"2015-03-04T05:06:07Z started":        "2015-03-04T05:06:07Z",
+		"2015-03-04T05:06:07.5+01:00 started": "2015-03-04T04:06:07.5Z",
+		"2015-03-04T05:06:07.123456789Z":      "2015-03-04T05:06:07.123456789Z",
+		"\tat com.example.Main(Main.java:42)": "",
+		"":                                    "",
+	} {
+		tm, ok := parse(line)
+		if expected == "" {
+			if ok {
+				t.Errorf("%q: expected no time, got %s", line, tm)
+			}
+			continue
+		}
+		if !ok || tm.UTC().Format(time.RFC3339Nano) != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", line, expected, tm, ok)
+		}
+	}
+}
+
+func TestTimeExtractor(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := func() time.Time { return time.Date(2016, 1, 1, 0, 30, 0, 0, time.UTC) }
+	for _, test := range []struct {
+		extractor TimeExtractor
+		line      string
+		expected  string
+	}{
+		{TimeExtractor{Layouts: []string{time.RFC3339, "2006-01-02 15:04:05"}},
+			"2015-03-04 05:06:07 started", "2015-03-04T05:06:07Z"},
+		{TimeExtractor{Layouts: []string{"2006-01-02 15:04:05"}, Location: paris},
+			"2015-03-04 05:06:07 started", "2015-03-04T04:06:07Z"},
+		{TimeExtractor{Layouts: []string{time.RFC3339}, Regexp: regexp.MustCompile(`time="([^"]+)"`)},
+			`level=info time="2015-03-04T05:06:07Z" msg=started`, "2015-03-04T05:06:07Z"},
+		{TimeExtractor{Epoch: EpochSeconds, Regexp: regexp.MustCompile(`"ts":([\d.]+)`)},
+			`{"ts":1425445567.25,"msg":"started"}`, "2015-03-04T05:06:07.25Z"},
+		{TimeExtractor{Epoch: EpochMillis},
+			"1425445567123 started", "2015-03-04T05:06:07.123Z"},
+		{TimeExtractor{Layouts: []string{time.Stamp}, Now: now},
+			"Dec 31 23:59:59 host app: started", "2015-12-31T23:59:59Z"},
+		{TimeExtractor{Layouts: []string{time.Stamp}, Now: now},
+			"Jan  1 00:10:00 host app: started", "2016-01-01T00:10:00Z"},
+		{TimeExtractor{Layouts: []string{time.RFC3339}},
+			"  continued", ""},
+		{TimeExtractor{Epoch: EpochSeconds}, "started", ""},
+	} {
+		tm, ok := test.extractor.Parse(test.line)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("%q: expected no time, got %s", test.line, tm)
+			}
+			continue
+		}
+		if !ok || tm.UTC().Format(time.RFC3339Nano) != test.expected {
+			t.Errorf("%q: expected %s, got %s (%v)", test.line, test.expected, tm, ok)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package tail
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// seekTime returns the offset of the first line of f whose time is at
+// or after t, or the size of f if there is none. It binary-searches
+// the file, assuming the times of its lines increase. Lines without a
+// time belong to the line before them.
+func seekTime(f io.ReadSeeker, t time.Time, parse TimeParser) (int64, error) {
+	size, err := f.Seek(0, os.SEEK_END)
+	if err != nil {
+		return 0, err
+	}
+	s := &timeSearch{f: f, parse: parse}
+
+	// The line sought starts at or after lo and before hi, or at found.
+	lo, hi, found := int64(0), size, size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := s.lineStart(mid, found)
+		if err != nil {
+			return 0, err
+		}
+		line, err := s.timedLine(start, found)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case line == nil:
+			// No line with a time between mid and found.
+			hi = mid
+		case line.time.Before(t):
+			lo = line.end
+		default:
+			found = line.start
+			hi = mid
+		}
+	}
+	return found, nil
+}
+
+// timeSearch reads lines at given offsets of a file.
+type timeSearch struct {
+	f      io.ReadSeeker
+	parse  TimeParser
+	reader *bufio.Reader
+	pos    int64 // Of the next byte of reader
+}
+
+func (s *timeSearch) seek(offset int64) error {
+	if _, err := s.f.Seek(offset, os.SEEK_SET); err != nil {
+		return err
+	}
+	if s.reader == nil {
+		s.reader = bufio.NewReader(s.f)
+	} else {
+		s.reader.Reset(s.f)
+	}
+	s.pos = offset
+	return nil
+}
+
+// readLine reads the line at the current position, returning its text
+// without the newline.
+func (s *timeSearch) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	s.pos += int64(len(line))
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	return line, err
+}
+
+// lineStart returns the offset of the first line starting at or after
+// offset, or limit if it is not before limit.
+func (s *timeSearch) lineStart(offset, limit int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+	// Start with the last byte before offset, in case it ends a line.
+	if err := s.seek(offset - 1); err != nil {
+		return 0, err
+	}
+	for s.pos < limit {
+		b, err := s.reader.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		s.pos++
+		if b == '\n' {
+			return s.pos, nil
+		}
+	}
+	return limit, nil
+}
+
+// timedLine is a line with a time, from start to end.
+type timedLine struct {
+	time       time.Time
+	start, end int64
+}
+
+// timedLine finds the first line with a time, starting with the line
+// at start and before limit, or returns nil if there is none.
+func (s *timeSearch) timedLine(start, limit int64) (*timedLine, error) {
+	if start >= limit {
+		return nil, nil
+	}
+	if err := s.seek(start); err != nil {
+		return nil, err
+	}
+	for s.pos < limit {
+		lineStart := s.pos
+		text, err := s.readLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if t, ok := s.parse(text); ok {
+			return &timedLine{t, lineStart, s.pos}, nil
+		}
+	}
+	return nil, nil
+}
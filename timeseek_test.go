@@ -0,0 +1,58 @@
+package tail
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeekTime(t *testing.T) {
+	// A line per minute from 10:00, with a continuation line every
+	// third line, and several lines at 10:05.
+	layout := "15:04"
+	var lines []string
+	for i := 0; i < 20; i++ {
+		minute := i
+		if i >= 5 && i < 8 {
+			minute = 5
+		}
+		lines = append(lines, fmt.Sprintf("10:%02d line %d", minute, i))
+		if i%3 == 0 {
+			lines = append(lines, "  continued")
+		}
+	}
+	content := strings.Join(lines, "\n") + "\n"
+
+	tailTest := NewTailTest("seek-time", t)
+	tailTest.CreateFile("test.txt", content)
+	f, err := os.Open(tailTest.path + "/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	parse := LayoutTimeParser(layout)
+	for minute := -1; minute <= 21; minute++ {
+		target := time.Date(0, 1, 1, 10, 0, 0, 0, time.UTC).Add(time.Duration(minute) * time.Minute)
+		// The first line at or after target, found linearly.
+		expected := int64(len(content))
+		offset := int64(0)
+		for _, line := range lines {
+			if tm, ok := parse(line); ok && !tm.Before(target) {
+				expected = offset
+				break
+			}
+			offset += int64(len(line)) + 1
+		}
+
+		got, err := seekTime(f, target, parse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("10:%02d: expected offset %d, got %d", minute, expected, got)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MemFS is an in-memory Notifier, meant to test tailing and rotation
+// without touching disk or waiting for polls.
+type MemFS struct {
+	mux   sync.Mutex
+	files map[string]*memNode
+	subs  map[string]map[*memSub]bool
+	now   func() time.Time
+}
+
+type memNode struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+type memSub struct {
+	ch   chan Event
+	done chan bool
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memNode),
+		subs:  make(map[string]map[*memSub]bool),
+		now:   time.Now,
+	}
+}
+
+// Create creates an empty file, replacing any file of that name.
+func (fs *MemFS) Create(name string) {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	fs.files[name] = &memNode{name: name, modTime: fs.now()}
+	fs.mux.Unlock()
+	fs.notify(name, Create)
+}
+
+// WriteFile creates a file holding data, replacing any file of that
+// name.
+func (fs *MemFS) WriteFile(name string, data string) {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	fs.files[name] = &memNode{name: name, data: []byte(data), modTime: fs.now()}
+	fs.mux.Unlock()
+	fs.notify(name, Create)
+}
+
+// Append appends data to an existing file.
+func (fs *MemFS) Append(name string, data string) error {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	node, ok := fs.files[name]
+	if ok {
+		node.data = append(node.data, data...)
+		node.modTime = fs.now()
+	}
+	fs.mux.Unlock()
+	if !ok {
+		return &os.PathError{Op: "append", Path: name, Err: os.ErrNotExist}
+	}
+	fs.notify(name, Write)
+	return nil
+}
+
+// Truncate changes the size of an existing file. Growing it is
+// reported as a Write, padding it with zeros.
+func (fs *MemFS) Truncate(name string, size int64) error {
+	name = filepath.Clean(name)
+	op := Write
+	fs.mux.Lock()
+	node, ok := fs.files[name]
+	if ok {
+		if size < int64(len(node.data)) {
+			op = Truncate
+		}
+		if size <= int64(len(node.data)) {
+			node.data = node.data[:size:size]
+		} else {
+			node.data = append(node.data, make([]byte, size-int64(len(node.data)))...)
+		}
+		node.modTime = fs.now()
+	}
+	fs.mux.Unlock()
+	if !ok {
+		return &os.PathError{Op: "truncate", Path: name, Err: os.ErrNotExist}
+	}
+	fs.notify(name, op)
+	return nil
+}
+
+// Rename moves a file, replacing any file named newname. Files opened
+// under the old name remain readable.
+func (fs *MemFS) Rename(oldname, newname string) error {
+	oldname = filepath.Clean(oldname)
+	newname = filepath.Clean(newname)
+	fs.mux.Lock()
+	node, ok := fs.files[oldname]
+	if ok {
+		delete(fs.files, oldname)
+		node.name = newname
+		fs.files[newname] = node
+	}
+	fs.mux.Unlock()
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	fs.notify(oldname, Rename)
+	fs.notify(newname, Create)
+	return nil
+}
+
+// Remove deletes a file. Files opened under that name remain readable.
+func (fs *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	_, ok := fs.files[name]
+	delete(fs.files, name)
+	fs.mux.Unlock()
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	fs.notify(name, Remove)
+	return nil
+}
+
+func (fs *MemFS) Open(name string) (File, error) {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	node, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFile{fs: fs, node: node}, nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	node, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFileInfo{node, filepath.Base(name), int64(len(node.data)), node.modTime}, nil
+}
+
+func (fs *MemFS) SameFile(fi1, fi2 os.FileInfo) bool {
+	mfi1, ok1 := fi1.(*memFileInfo)
+	mfi2, ok2 := fi2.(*memFileInfo)
+	return ok1 && ok2 && mfi1.node == mfi2.node
+}
+
+func (fs *MemFS) Subscribe(name string) (<-chan Event, func()) {
+	name = filepath.Clean(name)
+	sub := &memSub{make(chan Event), make(chan bool)}
+	fs.mux.Lock()
+	if fs.subs[name] == nil {
+		fs.subs[name] = make(map[*memSub]bool)
+	}
+	fs.subs[name][sub] = true
+	fs.mux.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			fs.mux.Lock()
+			delete(fs.subs[name], sub)
+			if len(fs.subs[name]) == 0 {
+				delete(fs.subs, name)
+			}
+			fs.mux.Unlock()
+			close(sub.done)
+		})
+	}
+	return sub.ch, cancel
+}
+
+// notify delivers an event to the subscribers of name, blocking until
+// each of them received it or cancelled its subscription.
+func (fs *MemFS) notify(name string, op Op) {
+	fs.mux.Lock()
+	subs := make([]*memSub, 0, len(fs.subs[name]))
+	for sub := range fs.subs[name] {
+		subs = append(subs, sub)
+	}
+	fs.mux.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- Event{name, op}:
+		case <-sub.done:
+		}
+	}
+}
+
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	offset int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mux.Lock()
+	defer f.fs.mux.Unlock()
+	switch whence {
+	case os.SEEK_CUR:
+		offset += f.offset
+	case os.SEEK_END:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return f.offset, &os.PathError{Op: "seek", Path: f.node.name, Err: os.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memFileInfo struct {
+	node    *memNode
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return 0600 }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return false }
+func (fi *memFileInfo) Sys() interface{}   { return fi.node }
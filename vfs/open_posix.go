@@ -1,6 +1,6 @@
 // +build linux darwin freebsd netbsd openbsd
 
-package tail
+package vfs
 
 import (
 	"os"
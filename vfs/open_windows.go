@@ -1,6 +1,6 @@
 // +build windows
 
-package tail
+package vfs
 
 import (
 	"github.com/hpcloud/tail/winfile"
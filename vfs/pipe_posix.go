@@ -0,0 +1,72 @@
+// +build linux darwin freebsd netbsd openbsd
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrPipeCancelled is returned by OpenPipe when cancelled.
+var ErrPipeCancelled = errors.New("vfs: pipe open cancelled")
+
+// pipeOpen is the outcome of opening a pipe.
+type pipeOpen struct {
+	file *os.File
+	err  error
+}
+
+// OpenPipe opens the named pipe (FIFO) for reading. It blocks until a
+// writer opens the pipe, or until cancel is closed.
+func OpenPipe(name string, cancel <-chan struct{}) (*os.File, error) {
+	done := make(chan pipeOpen, 1)
+	go func() {
+		f, err := os.OpenFile(name, os.O_RDONLY, 0)
+		done <- pipeOpen{f, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.file, r.err
+	case <-cancel:
+	}
+
+	// Pose as a writer to release the pending open. This fails with
+	// ENXIO until the open above has actually started.
+	for {
+		w, err := os.OpenFile(name, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			w.Close()
+		}
+		select {
+		case r := <-done:
+			if r.file != nil {
+				r.file.Close()
+			}
+			return nil, ErrPipeCancelled
+		case <-time.After(10 * time.Millisecond):
+		}
+		if err != nil && !isENXIO(err) {
+			// Eg: the pipe was removed, so that the open may never
+			// return. Close the file if it ever does.
+			go closePipe(done)
+			return nil, ErrPipeCancelled
+		}
+	}
+}
+
+// closePipe closes the file opened by OpenPipe after it was cancelled.
+func closePipe(done <-chan pipeOpen) {
+	if r := <-done; r.file != nil {
+		r.file.Close()
+	}
+}
+
+func isENXIO(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.ENXIO
+}
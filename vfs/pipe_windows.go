@@ -0,0 +1,17 @@
+// +build windows
+
+package vfs
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrPipeCancelled is returned by OpenPipe when cancelled.
+var ErrPipeCancelled = errors.New("vfs: pipe open cancelled")
+
+// OpenPipe opens the named pipe for reading. Windows named pipes are
+// opened like regular files, so cancel is ignored.
+func OpenPipe(name string, cancel <-chan struct{}) (*os.File, error) {
+	return OpenFile(name)
+}
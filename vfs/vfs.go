@@ -0,0 +1,97 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+// Package vfs abstracts the filesystem files are tailed from, so that
+// tail and its watchers can work on files that are not on disk.
+package vfs
+
+import (
+	"io"
+	"os"
+)
+
+// File is a file opened for tailing.
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// FS opens and stats files by name.
+type FS interface {
+	// Open opens the named file for reading. If the file does not
+	// exist, the error satisfies os.IsNotExist.
+	Open(name string) (File, error)
+
+	// Stat returns the FileInfo of the named file.
+	Stat(name string) (os.FileInfo, error)
+
+	// SameFile reports whether fi1 and fi2, as returned by Stat,
+	// describe the same file (eg: it was not replaced by rotation).
+	SameFile(fi1, fi2 os.FileInfo) bool
+}
+
+// OS is the FS of the operating system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) {
+	f, err := OpenFile(name)
+	if err != nil {
+		// Do not return a typed nil.
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) SameFile(fi1, fi2 os.FileInfo) bool {
+	return os.SameFile(fi1, fi2)
+}
+
+// Op describes a change reported by a Notifier.
+type Op int
+
+const (
+	Create Op = iota + 1
+	Write
+	Truncate
+	Remove
+	Rename
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "CREATE"
+	case Write:
+		return "WRITE"
+	case Truncate:
+		return "TRUNCATE"
+	case Remove:
+		return "REMOVE"
+	case Rename:
+		return "RENAME"
+	}
+	return "UNKNOWN"
+}
+
+// Event is a change to a named file.
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// Notifier is implemented by filesystems that report changes to their
+// files themselves, such as MemFS.
+type Notifier interface {
+	FS
+
+	// Subscribe returns a channel receiving the events on the named
+	// file, and a function to cancel the subscription. The channel is
+	// not closed on cancellation.
+	Subscribe(name string) (<-chan Event, func())
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/tomb.v1"
+)
+
+// HybridFileWatcher uses inotify to monitor file changes, and falls back to
+// polling when inotify watches cannot be added (ENOSPC, EMFILE) or when
+// inotify does not report changes that are visible through stat (NFS, FUSE
+// and some overlay filesystems).
+type HybridFileWatcher struct {
+	Filename string
+	Size     int64
+
+	// PollInterval and MaxPollInterval configure the polling watcher
+	// used after falling back; see PollingFileWatcher.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+
+	inotify FileWatcher // An *InotifyFileWatcher, but for tests
+	polling *PollingFileWatcher
+
+	mu   sync.Mutex
+	mode Mode
+}
+
+// HYBRID_CHECK_DURATION is the interval at which HybridFileWatcher stats the
+// file to verify that inotify is delivering events.
+var HYBRID_CHECK_DURATION = 5 * time.Second
+
+func NewHybridFileWatcher(filename string) *HybridFileWatcher {
+	filename = filepath.Clean(filename)
+	fw := &HybridFileWatcher{
+		Filename: filename,
+		inotify:  NewInotifyFileWatcher(filename),
+		polling:  NewPollingFileWatcher(filename),
+		mode:     ModeInotify,
+	}
+	return fw
+}
+
+// Mode reports whether the watcher currently uses inotify or has fallen back
+// to polling. Once fallen back, the watcher never returns to inotify.
+func (fw *HybridFileWatcher) Mode() Mode {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.mode
+}
+
+// poller returns the polling watcher set up with the configured intervals.
+func (fw *HybridFileWatcher) poller() *PollingFileWatcher {
+	fw.polling.Interval = fw.PollInterval
+	fw.polling.MaxInterval = fw.MaxPollInterval
+	return fw.polling
+}
+
+func (fw *HybridFileWatcher) fallBack(reason interface{}) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.mode == ModePolling {
+		return
+	}
+	fw.mode = ModePolling
+	logger.Printf("Falling back to polling for %s: %v", fw.Filename, reason)
+}
+
+func (fw *HybridFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
+	if fw.Mode() == ModePolling {
+		return fw.poller().BlockUntilExists(t)
+	}
+
+	inner := &tomb.Tomb{}
+	result := make(chan error, 1)
+	go func() {
+		result <- fw.inotify.BlockUntilExists(inner)
+	}()
+
+	ticker := time.NewTicker(HYBRID_CHECK_DURATION)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-result:
+			if !isInotifyExhausted(err) {
+				return err
+			}
+			fw.fallBack(err)
+			return fw.poller().BlockUntilExists(t)
+		case <-ticker.C:
+			if _, err := os.Stat(fw.Filename); err == nil {
+				// The file exists but inotify did not tell us.
+				inner.Kill(nil)
+				<-result
+				fw.fallBack("no create event received")
+				return nil
+			}
+		case <-t.Dying():
+			inner.Kill(nil)
+			<-result
+			return tomb.ErrDying
+		}
+	}
+}
+
+func (fw *HybridFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
+	fw.Size = pos
+	if fw.Mode() == ModePolling {
+		return fw.poller().ChangeEvents(t, pos)
+	}
+
+	inner := &tomb.Tomb{}
+	inotifyChanges, err := fw.inotify.ChangeEvents(inner, pos)
+	if err != nil {
+		if !isInotifyExhausted(err) {
+			return nil, err
+		}
+		fw.fallBack(err)
+		return fw.poller().ChangeEvents(t, pos)
+	}
+
+	changes := NewFileChanges()
+	go fw.supervise(t, inner, inotifyChanges, changes, pos, fw.stat())
+	return changes, nil
+}
+
+// supervise forwards inotify notifications to changes, and switches over to
+// polling when the file changes without inotify noticing.
+//
+// reported is the state of the file when inotify last reported a change, at
+// first when watching started. seen is set when inotify reported anything
+// since the last check; pending when the last check found the file changed
+// since reported.
+func (fw *HybridFileWatcher) supervise(t, inner *tomb.Tomb, src, changes *FileChanges, pos int64, reported fileState) {
+	ticker := time.NewTicker(HYBRID_CHECK_DURATION)
+	defer ticker.Stop()
+
+	seen, pending := false, false
+
+	for {
+		select {
+		case <-src.Modified:
+			seen = true
+			changes.NotifyModified()
+		case <-src.Truncated:
+			seen = true
+			changes.NotifyTruncated()
+		case <-src.Deleted:
+			inner.Kill(nil)
+			changes.NotifyDeleted()
+			return
+		case <-t.Dying():
+			inner.Kill(nil)
+			return
+		case <-ticker.C:
+			current := fw.stat()
+			if seen {
+				reported, seen, pending = current, false, false
+				continue
+			}
+			if current.same(reported) {
+				pending = false
+				continue
+			}
+			if !pending {
+				pending = true
+				continue
+			}
+
+			// A change went unreported for a whole check interval,
+			// and the file still differs from when inotify last
+			// reported it, unless a notification is just in.
+			select {
+			case <-src.Modified:
+				changes.NotifyModified()
+				reported, pending = current, false
+				continue
+			case <-src.Truncated:
+				changes.NotifyTruncated()
+				reported, pending = current, false
+				continue
+			default:
+			}
+			inner.Kill(nil)
+			fw.fallBack("file changed without inotify events")
+			pollChanges, err := fw.poller().ChangeEvents(t, pos)
+			if err != nil {
+				changes.NotifyDeleted()
+				return
+			}
+			changes.NotifyModified()
+			forward(t, pollChanges, changes)
+			return
+		}
+	}
+}
+
+// fileState is the size and modification time of a file, or a size of
+// -1 when it cannot be stat'ed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s fileState) same(o fileState) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+func (fw *HybridFileWatcher) stat() fileState {
+	fi, err := os.Stat(fw.Filename)
+	if err != nil {
+		return fileState{size: -1}
+	}
+	return fileState{fi.Size(), fi.ModTime()}
+}
+
+// forward relays notifications from src to dst until the file is deleted or
+// the tomb starts dying.
+func forward(t *tomb.Tomb, src, dst *FileChanges) {
+	for {
+		select {
+		case <-src.Modified:
+			dst.NotifyModified()
+		case <-src.Truncated:
+			dst.NotifyTruncated()
+		case <-src.Deleted:
+			dst.NotifyDeleted()
+			return
+		case <-t.Dying():
+			return
+		}
+	}
+}
+
+// isInotifyExhausted returns true if err indicates that the inotify watch or
+// instance limits were reached.
+func isInotifyExhausted(err error) bool {
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.ENOSPC || err == syscall.EMFILE
+}
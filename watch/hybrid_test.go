@@ -0,0 +1,138 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"gopkg.in/tomb.v1"
+)
+
+// fakeInotify is a FileWatcher failing with err, or else reporting no
+// change at all, like inotify on some network filesystems.
+type fakeInotify struct {
+	err error
+}
+
+func (w *fakeInotify) BlockUntilExists(t *tomb.Tomb) error {
+	if w.err != nil {
+		return w.err
+	}
+	<-t.Dying()
+	return tomb.ErrDying
+}
+
+func (w *fakeInotify) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return NewFileChanges(), nil
+}
+
+// newHybridTest returns a HybridFileWatcher of a new file, watching it
+// with inotify.
+func newHybridTest(t *testing.T, inotify FileWatcher) (*HybridFileWatcher, string) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "test.txt")
+	if err := ioutil.WriteFile(filename, []byte("hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fw := NewHybridFileWatcher(filename)
+	fw.inotify = inotify
+	fw.PollInterval = 10 * time.Millisecond
+	return fw, dir
+}
+
+// expectModified appends to filename, and waits for changes to report
+// it.
+func expectModified(t *testing.T, filename string, changes *FileChanges) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("world\n")
+	f.Close()
+	select {
+	case <-changes.Modified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the file to be reported modified")
+	}
+}
+
+func TestHybridFallsBackWhenInotifyIsExhausted(t *testing.T) {
+	for _, err := range []error{
+		&os.SyscallError{Syscall: "inotify_add_watch", Err: syscall.ENOSPC},
+		syscall.EMFILE,
+	} {
+		fw, dir := newHybridTest(t, &fakeInotify{err: err})
+		defer os.RemoveAll(dir)
+		var tb tomb.Tomb
+		changes, err := fw.ChangeEvents(&tb, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fw.Mode() != ModePolling {
+			t.Errorf("expected to fall back to polling, got %v", fw.Mode())
+		}
+		expectModified(t, fw.Filename, changes)
+		tb.Kill(nil)
+	}
+
+	// Other errors are returned.
+	fw, dir := newHybridTest(t, &fakeInotify{err: syscall.EACCES})
+	defer os.RemoveAll(dir)
+	if _, err := fw.ChangeEvents(&tomb.Tomb{}, 6); err != syscall.EACCES {
+		t.Errorf("expected EACCES, got %v", err)
+	}
+	if fw.Mode() != ModeInotify {
+		t.Errorf("expected to keep inotify, got %v", fw.Mode())
+	}
+}
+
+func TestHybridFallsBackWhenInotifyMissesChanges(t *testing.T) {
+	defer func(d time.Duration) { HYBRID_CHECK_DURATION = d }(HYBRID_CHECK_DURATION)
+	HYBRID_CHECK_DURATION = 10 * time.Millisecond
+
+	fw, dir := newHybridTest(t, &fakeInotify{})
+	defer os.RemoveAll(dir)
+	var tb tomb.Tomb
+	defer tb.Kill(nil)
+	changes, err := fw.ChangeEvents(&tb, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.Mode() != ModeInotify {
+		t.Fatalf("expected inotify, got %v", fw.Mode())
+	}
+	expectModified(t, fw.Filename, changes)
+	if fw.Mode() != ModePolling {
+		t.Errorf("expected to fall back to polling, got %v", fw.Mode())
+	}
+}
+
+func TestHybridKeepsInotifyWhileTheFileIsUnchanged(t *testing.T) {
+	defer func(d time.Duration) { HYBRID_CHECK_DURATION = d }(HYBRID_CHECK_DURATION)
+	HYBRID_CHECK_DURATION = 10 * time.Millisecond
+
+	// The file is larger than the position watched from, but does not
+	// change: there is nothing for inotify to report.
+	fw, dir := newHybridTest(t, &fakeInotify{})
+	defer os.RemoveAll(dir)
+	var tb tomb.Tomb
+	defer tb.Kill(nil)
+	if _, err := fw.ChangeEvents(&tb, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * HYBRID_CHECK_DURATION)
+	if fw.Mode() != ModeInotify {
+		t.Errorf("expected to keep inotify, got %v", fw.Mode())
+	}
+}
@@ -25,6 +25,11 @@ func NewInotifyFileWatcher(filename string) *InotifyFileWatcher {
 	return fw
 }
 
+// Mode returns ModeInotify.
+func (fw *InotifyFileWatcher) Mode() Mode {
+	return ModeInotify
+}
+
 func (fw *InotifyFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
 	err := WatchCreate(fw.Filename)
 	if err != nil {
@@ -10,8 +10,6 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/hpcloud/tail/util"
-
 	"gopkg.in/fsnotify/fsnotify.v1"
 )
 
@@ -216,7 +214,18 @@ func (shared *InotifyTracker) sendEvent(event fsnotify.Event) {
 func (shared *InotifyTracker) run() {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		util.Fatal("failed to create Watcher")
+		// inotify is unavailable (eg: fs.inotify.max_user_instances was
+		// reached); report the failure to every watch request so that
+		// callers can fall back to polling.
+		logger.Printf("Failed to create Watcher: %s", err)
+		for {
+			select {
+			case <-shared.watch:
+				shared.error <- err
+			case <-shared.remove:
+				shared.error <- err
+			}
+		}
 	}
 	shared.watcher = watcher
 
@@ -0,0 +1,85 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/hpcloud/tail/vfs"
+	"gopkg.in/tomb.v1"
+)
+
+// NotifyingFileWatcher monitors file changes through the events reported
+// by a vfs.Notifier, such as vfs.MemFS.
+type NotifyingFileWatcher struct {
+	Filename string
+	FS       vfs.Notifier
+}
+
+func NewNotifyingFileWatcher(fs vfs.Notifier, filename string) *NotifyingFileWatcher {
+	fw := &NotifyingFileWatcher{filepath.Clean(filename), fs}
+	return fw
+}
+
+func (fw *NotifyingFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
+	events, cancel := fw.FS.Subscribe(fw.Filename)
+	defer cancel()
+
+	// The file may have been created before subscribing.
+	if _, err := fw.FS.Stat(fw.Filename); !os.IsNotExist(err) {
+		return err
+	}
+
+	for {
+		select {
+		case evt := <-events:
+			if evt.Op == vfs.Create {
+				return nil
+			}
+		case <-t.Dying():
+			return tomb.ErrDying
+		}
+	}
+}
+
+func (fw *NotifyingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
+	events, cancel := fw.FS.Subscribe(fw.Filename)
+	changes := NewFileChanges()
+
+	// Report changes made before subscribing.
+	fi, err := fw.FS.Stat(fw.Filename)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if fi.Size() < pos {
+		changes.NotifyTruncated()
+	} else if fi.Size() > pos {
+		changes.NotifyModified()
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			var evt vfs.Event
+			select {
+			case evt = <-events:
+			case <-t.Dying():
+				return
+			}
+
+			switch evt.Op {
+			case vfs.Remove, vfs.Rename, vfs.Create:
+				changes.NotifyDeleted()
+				return
+			case vfs.Truncate:
+				changes.NotifyTruncated()
+			case vfs.Write:
+				changes.NotifyModified()
+			}
+		}
+	}()
+
+	return changes, nil
+}
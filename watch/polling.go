@@ -4,11 +4,12 @@
 package watch
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 	"time"
 
-	"github.com/hpcloud/tail/util"
+	"github.com/hpcloud/tail/vfs"
 	"gopkg.in/tomb.v1"
 )
 
@@ -16,103 +17,174 @@ import (
 type PollingFileWatcher struct {
 	Filename string
 	Size     int64
+
+	// Interval is the delay between two polls. POLL_DURATION is used
+	// when zero.
+	Interval time.Duration
+	// MaxInterval enables adaptive polling when greater than Interval:
+	// the delay doubles after every poll that finds the file unchanged,
+	// up to MaxInterval, and drops back to Interval on any change.
+	MaxInterval time.Duration
+
+	// Scheduler performs the polling; the shared scheduler is used
+	// when nil.
+	Scheduler *PollingScheduler
+
+	// FS is the filesystem holding the file; vfs.OS when nil.
+	FS vfs.FS
 }
 
 func NewPollingFileWatcher(filename string) *PollingFileWatcher {
-	fw := &PollingFileWatcher{filename, 0}
+	fw := &PollingFileWatcher{Filename: filename}
 	return fw
 }
 
+// Mode returns ModePolling.
+func (fw *PollingFileWatcher) Mode() Mode {
+	return ModePolling
+}
+
 var POLL_DURATION time.Duration
 
+// interval returns the delay to use after a change was seen.
+func (fw *PollingFileWatcher) interval() time.Duration {
+	if fw.Interval > 0 {
+		return fw.Interval
+	}
+	return POLL_DURATION
+}
+
+// backoff returns the delay to use after a poll that found no change.
+func (fw *PollingFileWatcher) backoff(cur time.Duration) time.Duration {
+	if fw.MaxInterval <= cur {
+		return cur
+	}
+	next := cur * 2
+	if next > fw.MaxInterval {
+		next = fw.MaxInterval
+	}
+	return next
+}
+
+func (fw *PollingFileWatcher) fs() vfs.FS {
+	if fw.FS != nil {
+		return fw.FS
+	}
+	return vfs.OS
+}
+
+func (fw *PollingFileWatcher) scheduler() *PollingScheduler {
+	if fw.Scheduler != nil {
+		return fw.Scheduler
+	}
+	return sharedPollingScheduler()
+}
+
 func (fw *PollingFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
-	for {
-		if _, err := os.Stat(fw.Filename); err == nil {
-			return nil
-		} else if !os.IsNotExist(err) {
-			return err
-		}
-		select {
-		case <-time.After(POLL_DURATION):
-			continue
-		case <-t.Dying():
-			return tomb.ErrDying
+	if _, err := fw.fs().Stat(fw.Filename); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	result := make(chan error, 1)
+	fw.scheduler().add(fw, t, func(fi os.FileInfo, err error) (bool, bool) {
+		if err == nil || !os.IsNotExist(err) {
+			result <- err
+			return true, true
 		}
+		return false, false
+	})
+
+	select {
+	case err := <-result:
+		return err
+	case <-t.Dying():
+		return tomb.ErrDying
 	}
-	panic("unreachable")
 }
 
 func (fw *PollingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
-	origFi, err := os.Stat(fw.Filename)
-	if err != nil {
+	origFi, err := fw.fs().Stat(fw.Filename)
+	if err != nil && !isTemporary(err) {
 		return nil, err
 	}
 
 	changes := NewFileChanges()
 	var prevModTime time.Time
 
-	// XXX: use tomb.Tomb to cleanly manage these goroutines. replace
-	// the fatal (below) with tomb's Kill.
-
 	fw.Size = pos
-
-	go func() {
-		prevSize := fw.Size
-		for {
-			select {
-			case <-t.Dying():
-				return
-			default:
+	prevSize := fw.Size
+
+	fw.scheduler().add(fw, t, func(fi os.FileInfo, err error) (changed, done bool) {
+		if err != nil {
+			// Windows cannot delete a file if a handle is still open (tail keeps one open)
+			// so it gives access denied to anything trying to read it until all handles are released.
+			if os.IsNotExist(err) || (runtime.GOOS == "windows" && os.IsPermission(err)) {
+				// File does not exist (has been deleted).
+				changes.NotifyDeleted()
+				return true, true
 			}
 
-			time.Sleep(POLL_DURATION)
-			fi, err := os.Stat(fw.Filename)
-			if err != nil {
-				// Windows cannot delete a file if a handle is still open (tail keeps one open)
-				// so it gives access denied to anything trying to read it until all handles are released.
-				if os.IsNotExist(err) || (runtime.GOOS == "windows" && os.IsPermission(err)) {
-					// File does not exist (has been deleted).
-					changes.NotifyDeleted()
-					return
-				}
-
-				// XXX: report this error back to the user
-				util.Fatal("Failed to stat file %v: %v", fw.Filename, err)
+			if isTemporary(err) {
+				// Eg: a server of vfs files briefly unavailable.
+				return false, false
 			}
+			t.Kill(fmt.Errorf("Failed to stat file %v: %v", fw.Filename, err))
+			return true, true
+		}
 
-			// File got moved/renamed?
-			if !os.SameFile(origFi, fi) {
-				changes.NotifyDeleted()
-				return
-			}
+		if origFi == nil {
+			// Not known yet, after a temporary error.
+			origFi = fi
+		}
 
-			// File got truncated?
-			fw.Size = fi.Size()
-			if prevSize > 0 && prevSize > fw.Size {
-				changes.NotifyTruncated()
-				prevSize = fw.Size
-				continue
-			}
-			// File got bigger?
-			if prevSize > 0 && prevSize < fw.Size {
-				changes.NotifyModified()
-				prevSize = fw.Size
-				continue
-			}
-			prevSize = fw.Size
+		// File got moved/renamed?
+		if !fw.fs().SameFile(origFi, fi) {
+			changes.NotifyDeleted()
+			return true, true
+		}
 
-			// File was appended to (changed)?
-			modTime := fi.ModTime()
-			if modTime != prevModTime {
-				prevModTime = modTime
-				changes.NotifyModified()
-			}
+		// File got truncated?
+		fw.Size = fi.Size()
+		if prevSize > 0 && prevSize > fw.Size {
+			changes.NotifyTruncated()
+			prevSize = fw.Size
+			return true, false
+		}
+		// File got bigger?
+		if prevSize > 0 && prevSize < fw.Size {
+			changes.NotifyModified()
+			prevSize = fw.Size
+			return true, false
+		}
+		prevSize = fw.Size
+
+		// File was appended to (changed)?
+		modTime := fi.ModTime()
+		if modTime != prevModTime {
+			prevModTime = modTime
+			changes.NotifyModified()
+			return true, false
 		}
-	}()
+		return false, false
+	})
 
 	return changes, nil
 }
 
+// isTemporary reports whether err, or the error of an *os.PathError,
+// is temporary, like net.Error.
+func isTemporary(err error) bool {
+	if perr, ok := err.(*os.PathError); ok {
+		err = perr.Err
+	}
+	terr, ok := err.(interface {
+		Temporary() bool
+	})
+	return ok && terr.Temporary()
+}
+
 func init() {
 	POLL_DURATION = 250 * time.Millisecond
 }
@@ -0,0 +1,260 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package watch
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v1"
+)
+
+var (
+	// POLL_CONCURRENCY bounds the number of concurrent stat calls made
+	// by the shared PollingScheduler.
+	POLL_CONCURRENCY = 16
+
+	// POLL_JITTER is the fraction of the poll interval over which the
+	// polls of different files are spread, so that files added
+	// together do not keep being stat'ed together. Each file gets its
+	// own offset, so that its watchers are still polled as one batch.
+	POLL_JITTER = 0.1
+
+	sharedPolling     *PollingScheduler
+	sharedPollingOnce sync.Once
+)
+
+// sweepInterval is how often the queue is cleared of the entries of
+// dying tombs, which are otherwise dropped once due.
+const sweepInterval = time.Second
+
+func sharedPollingScheduler() *PollingScheduler {
+	sharedPollingOnce.Do(func() {
+		sharedPolling = NewPollingScheduler(POLL_CONCURRENCY)
+	})
+	return sharedPolling
+}
+
+// PollingScheduler polls the files of many PollingFileWatchers from a
+// fixed set of goroutines. Files due at the same time are stat'ed as
+// one batch, with a single stat per file name, and the result is fanned
+// out to every watcher of that file.
+type PollingScheduler struct {
+	mux   sync.Mutex
+	queue pollQueue
+	wake  chan bool
+	jobs  chan []*pollEntry
+}
+
+// pollFunc is called with the result of each stat of a polled file. It
+// returns whether the file changed, which resets the poll interval, and
+// whether polling is done.
+type pollFunc func(fi os.FileInfo, err error) (changed, done bool)
+
+type pollEntry struct {
+	fw       *PollingFileWatcher
+	t        *tomb.Tomb
+	poll     pollFunc
+	interval time.Duration
+	due      time.Time
+}
+
+// NewPollingScheduler starts a scheduler making at most concurrency
+// stat calls at a time.
+func NewPollingScheduler(concurrency int) *PollingScheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &PollingScheduler{
+		wake: make(chan bool, 1),
+		jobs: make(chan []*pollEntry),
+	}
+	for i := 0; i < concurrency; i++ {
+		go s.work()
+	}
+	go s.run()
+	return s
+}
+
+// add starts polling fw's file until poll reports done or t is dying.
+func (s *PollingScheduler) add(fw *PollingFileWatcher, t *tomb.Tomb, poll pollFunc) {
+	e := &pollEntry{fw: fw, t: t, poll: poll, interval: fw.interval()}
+	s.schedule(e, time.Now())
+}
+
+// schedule queues e to be polled after its interval from now, unless t
+// is dying.
+func (s *PollingScheduler) schedule(e *pollEntry, now time.Time) {
+	if e.dying() {
+		return
+	}
+	e.due = dueTime(e.fw, e.interval, now)
+	s.mux.Lock()
+	heap.Push(&s.queue, e)
+	s.mux.Unlock()
+	sendOnlyIfEmpty(s.wake)
+}
+
+// sweep removes the entries of dying tombs from the queue. The caller
+// must hold s.mux.
+func (s *PollingScheduler) sweep() {
+	live := s.queue[:0]
+	for _, e := range s.queue {
+		if !e.dying() {
+			live = append(live, e)
+		}
+	}
+	for i := len(live); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = live
+	heap.Init(&s.queue)
+}
+
+func (e *pollEntry) dying() bool {
+	select {
+	case <-e.t.Dying():
+		return true
+	default:
+		return false
+	}
+}
+
+// len returns the number of queued entries.
+func (s *PollingScheduler) len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.queue)
+}
+
+// run dispatches due entries to the workers, grouped by file name, and
+// drops those of dying tombs.
+func (s *PollingScheduler) run() {
+	var swept time.Time
+	for {
+		now := time.Now()
+		var batch []*pollEntry
+		wait := time.Duration(-1)
+
+		s.mux.Lock()
+		if now.Sub(swept) >= sweepInterval {
+			s.sweep()
+			swept = now
+		}
+		for len(s.queue) > 0 && !s.queue[0].due.After(now) {
+			if e := heap.Pop(&s.queue).(*pollEntry); !e.dying() {
+				batch = append(batch, e)
+			}
+		}
+		if len(s.queue) > 0 {
+			wait = s.queue[0].due.Sub(now)
+			if next := swept.Add(sweepInterval).Sub(now); next < wait {
+				wait = next
+			}
+		}
+		s.mux.Unlock()
+
+		if len(batch) > 0 {
+			for _, group := range groupByFilename(batch) {
+				s.jobs <- group
+			}
+			continue
+		}
+
+		if wait < 0 {
+			<-s.wake
+			continue
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.wake:
+		}
+	}
+}
+
+// work stats files and reschedules the entries that are not done.
+func (s *PollingScheduler) work() {
+	for group := range s.jobs {
+		fi, err := group[0].fw.fs().Stat(group[0].fw.Filename)
+		now := time.Now()
+		for _, e := range group {
+			if e.dying() {
+				continue
+			}
+			changed, done := e.poll(fi, err)
+			if done {
+				continue
+			}
+			if changed {
+				e.interval = e.fw.interval()
+			} else {
+				e.interval = e.fw.backoff(e.interval)
+			}
+			s.schedule(e, now)
+		}
+	}
+}
+
+// groupByFilename groups the entries of the same file of the same
+// filesystem.
+func groupByFilename(batch []*pollEntry) [][]*pollEntry {
+	type key struct {
+		fs   interface{}
+		name string
+	}
+	var groups [][]*pollEntry
+	index := make(map[key]int)
+	for _, e := range batch {
+		k := key{e.fw.fs(), e.fw.Filename}
+		if !reflect.TypeOf(k.fs).Comparable() {
+			// Cannot tell whether it is the same filesystem as
+			// another's: stat the file for e alone.
+			k.fs = e
+		}
+		if i, ok := index[k]; ok {
+			groups[i] = append(groups[i], e)
+			continue
+		}
+		index[k] = len(groups)
+		groups = append(groups, []*pollEntry{e})
+	}
+	return groups
+}
+
+// dueTime returns when to poll the file of fw next: at most interval
+// after now, on a grid of that interval shifted by an offset of the
+// file within POLL_JITTER of the interval. Watchers of a file with the
+// same interval are thus due together, whenever they were added.
+func dueTime(fw *PollingFileWatcher, interval time.Duration, now time.Time) time.Time {
+	var offset time.Duration
+	if spread := int64(float64(interval) * POLL_JITTER); spread > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(fw.Filename))
+		offset = time.Duration(int64(h.Sum32()) % spread)
+	}
+	return now.Add(interval - offset).Truncate(interval).Add(offset)
+}
+
+// pollQueue is a heap of entries ordered by due time.
+type pollQueue []*pollEntry
+
+func (q pollQueue) Len() int           { return len(q) }
+func (q pollQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q pollQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *pollQueue) Push(x interface{}) {
+	*q = append(*q, x.(*pollEntry))
+}
+
+func (q *pollQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
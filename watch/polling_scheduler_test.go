@@ -0,0 +1,145 @@
+// Copyright (c) 2015 HPE Software Inc. All rights reserved.
+
+package watch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail/vfs"
+	"gopkg.in/tomb.v1"
+)
+
+// statFS is a vfs.FS of files that always exist, taking delay to stat
+// them, and counting how many are stat'ed at once.
+type statFS struct {
+	vfs.FS
+	delay time.Duration
+
+	mux                        sync.Mutex
+	stats, running, maxRunning int
+}
+
+func (fs *statFS) Stat(name string) (os.FileInfo, error) {
+	fs.mux.Lock()
+	fs.stats++
+	fs.running++
+	if fs.running > fs.maxRunning {
+		fs.maxRunning = fs.running
+	}
+	fs.mux.Unlock()
+	time.Sleep(fs.delay)
+	fs.mux.Lock()
+	fs.running--
+	fs.mux.Unlock()
+	return &fileInfo{name: name}, nil
+}
+
+// fileInfo is the os.FileInfo of a file of statFS.
+type fileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func TestPollingSchedulerConcurrency(t *testing.T) {
+	s := NewPollingScheduler(2)
+	fs := &statFS{delay: 20 * time.Millisecond}
+	var tb tomb.Tomb
+	defer tb.Kill(nil)
+	polled := make(chan bool)
+	for i := 0; i < 10; i++ {
+		fw := &PollingFileWatcher{Filename: fmt.Sprintf("file%d", i), Interval: 5 * time.Millisecond, FS: fs}
+		s.add(fw, &tb, func(fi os.FileInfo, err error) (changed, done bool) {
+			polled <- true
+			return false, true
+		})
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-polled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the files to be polled")
+		}
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if fs.maxRunning != 2 {
+		t.Errorf("expected 2 files to be stat'ed at once, got %d", fs.maxRunning)
+	}
+}
+
+func TestPollingSchedulerBatchesFile(t *testing.T) {
+	s := NewPollingScheduler(4)
+	fs := &statFS{}
+	var tb tomb.Tomb
+	defer tb.Kill(nil)
+
+	// Watchers added at different times, within one interval, end up
+	// polled together from the first or the second poll on.
+	const watchers, polls = 5, 4
+	finished := make(chan bool, watchers)
+	for i := 0; i < watchers; i++ {
+		n := 0
+		fw := &PollingFileWatcher{Filename: "app.log", Interval: 10 * time.Millisecond, FS: fs}
+		s.add(fw, &tb, func(fi os.FileInfo, err error) (changed, done bool) {
+			if n++; n < polls {
+				return true, false
+			}
+			finished <- true
+			return true, true
+		})
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < watchers; i++ {
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the file to be polled")
+		}
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if fs.stats > polls+1 {
+		t.Errorf("expected at most %d stats, got %d", polls+1, fs.stats)
+	}
+}
+
+func TestPollingSchedulerRemovesDyingEntries(t *testing.T) {
+	s := NewPollingScheduler(1)
+	var tb tomb.Tomb
+	fw := &PollingFileWatcher{Filename: "app.log", Interval: time.Hour, FS: &statFS{}}
+	s.add(fw, &tb, func(fi os.FileInfo, err error) (changed, done bool) {
+		t.Error("unexpected poll")
+		return false, true
+	})
+	if n := s.len(); n != 1 {
+		t.Fatalf("expected 1 queued entry, got %d", n)
+	}
+	tb.Kill(nil)
+	for i := 0; s.len() > 0; i++ {
+		if i == 300 {
+			t.Fatal("expected the entry to be removed once its tomb is dying")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sliceFS is a vfs.FS whose values cannot be compared.
+type sliceFS struct {
+	vfs.FS
+	names []string
+}
+
+func TestGroupByFilenameIncomparableFS(t *testing.T) {
+	var batch []*pollEntry
+	for i := 0; i < 2; i++ {
+		fw := &PollingFileWatcher{Filename: "app.log", FS: sliceFS{}}
+		batch = append(batch, &pollEntry{fw: fw})
+	}
+	if groups := groupByFilename(batch); len(groups) != 2 {
+		t.Errorf("expected a group per entry, got %d", len(groups))
+	}
+}
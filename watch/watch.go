@@ -18,3 +18,22 @@ type FileWatcher interface {
 	// the caller to pass their current offset in the file.
 	ChangeEvents(*tomb.Tomb, int64) (*FileChanges, error)
 }
+
+// Mode identifies the mechanism used by a FileWatcher to detect changes.
+type Mode int
+
+const (
+	ModeUnknown Mode = iota
+	ModeInotify
+	ModePolling
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeInotify:
+		return "inotify"
+	case ModePolling:
+		return "polling"
+	}
+	return "unknown"
+}